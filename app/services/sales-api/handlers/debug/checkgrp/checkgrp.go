@@ -8,16 +8,16 @@ import (
 	"os"
 	"time"
 
-	"github.com/jmoiron/sqlx"
 	"github.com/piyush-saurabh/go-service/business/sys/database"
 	"go.uber.org/zap"
 )
 
 // Handlers manages the set of check enpoints.
 type Handlers struct {
-	Build string
-	Log   *zap.SugaredLogger
-	DB    *sqlx.DB
+	Build    string
+	Log      *zap.SugaredLogger
+	DB       *database.DB
+	Migrated <-chan struct{} // closed once startup migrations are done, nil if there are none
 }
 
 // Readiness checks if the database is ready and if not will return a 500 status.
@@ -28,13 +28,31 @@ func (h Handlers) Readiness(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), time.Second)
 	defer cancel()
 
+	// While the circuit is open the service is reported as not ready. The
+	// check leaves the breaker alone, it closes once a query let through
+	// after the cooldown succeeds.
 	status := "ok"
 	statusCode := http.StatusOK
-	if err := database.StatusCheck(ctx, h.DB); err != nil {
+	if err := database.StatusCheck(ctx, h.DB.DB); err != nil {
 		status = "db not ready"
 		statusCode = http.StatusInternalServerError
 	}
 
+	if h.DB.Breaker().Open() {
+		status = "db circuit open"
+		statusCode = http.StatusInternalServerError
+	}
+
+	// The service is not ready until the startup migrations have finished.
+	if h.Migrated != nil {
+		select {
+		case <-h.Migrated:
+		default:
+			status = "migrations not complete"
+			statusCode = http.StatusInternalServerError
+		}
+	}
+
 	data := struct {
 		Status string `json:"status"`
 	}{
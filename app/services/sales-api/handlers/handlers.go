@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/pprof"
 	"os"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/piyush-saurabh/go-service/app/services/sales-api/handlers/debug/checkgrp"
@@ -13,7 +14,11 @@ import (
 	v1UserGrp "github.com/piyush-saurabh/go-service/app/services/sales-api/handlers/v1/usergrp"
 	userCore "github.com/piyush-saurabh/go-service/business/core/user"
 	"github.com/piyush-saurabh/go-service/business/sys/auth"
+	"github.com/piyush-saurabh/go-service/business/sys/database"
+	"github.com/piyush-saurabh/go-service/business/sys/ratelimit"
+	"github.com/piyush-saurabh/go-service/business/sys/validate"
 	"github.com/piyush-saurabh/go-service/business/web/mid"
+	"github.com/piyush-saurabh/go-service/foundation/logger"
 	"github.com/piyush-saurabh/go-service/foundation/web"
 	"go.uber.org/zap"
 )
@@ -38,10 +43,24 @@ func DebugStandardLibraryMux() *http.ServeMux {
 
 // APIMuxConfig contains all the mandatory systems required by handlers.
 type APIMuxConfig struct {
-	Shutdown chan os.Signal
-	Log      *zap.SugaredLogger
-	Auth     *auth.Auth
-	DB       *sqlx.DB
+	Shutdown  chan os.Signal
+	Log       *zap.SugaredLogger
+	LogLevel  *logger.Level
+	Logger    mid.LoggerConfig
+	Compress  mid.CompressConfig
+	CORS      mid.CORSConfig
+	RateLimit mid.RateLimitConfig
+	Auth      *auth.Auth
+	DB        sqlx.ExtContext // a *database.DB routes reads to replicas
+
+	MaxBodySize int64 // zero keeps web.DefaultMaxBodySize, less than zero removes the limit
+
+	UserRateLimit  ratelimit.Limit // per subject on the user routes, zero disables it
+	TokenRateLimit ratelimit.Limit // per client address on the token route, zero disables it
+
+	MaxInFlight    int           // requests handled at once before shedding, zero disables it
+	RequestTimeout time.Duration // deadline for a route, zero disables it
+	ExportTimeout  time.Duration // deadline for streaming exports, zero disables it
 }
 
 // APIMux constructs an http.Handler with all application routes defined.
@@ -49,13 +68,30 @@ func APIMux(cfg APIMuxConfig) *web.App {
 	//mux := httptreemux.NewContextMux() // NewContextMux implements the http.Handler
 	// Construct the web.App which holds all routes as well as common Middleware.
 	// [PS] The order of middleware is from top (outer) to bottom (inner). Order of execution will be from top to bottom
+	// Per-request debug logging is only available when the logger was
+	// constructed with a runtime adjustable level.
+	var debug web.Middleware
+	if cfg.LogLevel != nil {
+		debug = mid.DebugLogging(cfg.Log, cfg.Auth, cfg.LogLevel)
+	}
+
 	app := web.NewApp(
 		cfg.Shutdown,
-		mid.Logger(cfg.Log),
+		debug,
+		mid.Logger(cfg.Log, cfg.Logger),
 		mid.Errors(cfg.Log),
+		mid.CORS(cfg.CORS),
+		mid.Compress(cfg.Compress),
 		mid.Metrics(),
+		mid.Shed(cfg.MaxInFlight),
 		mid.Panics(),
 	)
+	if cfg.MaxBodySize != 0 {
+		app.SetMaxBodySize(cfg.MaxBodySize)
+	}
+
+	// Decoded requests are checked against their validation tags.
+	app.SetCheck(validate.Check)
 
 	// Binding the different versions/group (e.g v1) Routes
 	v1(app, cfg)
@@ -67,14 +103,18 @@ func APIMux(cfg APIMuxConfig) *web.App {
 // debug application routes for the service. This bypassing the use of the
 // DefaultServerMux. Using the DefaultServerMux would be a security risk since
 // a dependency could inject a handler into our service without us knowing it.
-func DebugMux(build string, log *zap.SugaredLogger, db *sqlx.DB) http.Handler {
+func DebugMux(build string, log *zap.SugaredLogger, db *database.DB, level *logger.Level, migrated <-chan struct{}) http.Handler {
 	mux := DebugStandardLibraryMux()
 
+	// Register the endpoint for reading (GET) and changing (PUT) the log level.
+	mux.Handle("/debug/loglevel", level)
+
 	// Register debug check endpoints.
 	cgh := checkgrp.Handlers{
-		Build: build,
-		Log:   log,
-		DB:    db,
+		Build:    build,
+		Log:      log,
+		DB:       db,
+		Migrated: migrated,
 	}
 	mux.HandleFunc("/debug/readiness", cgh.Readiness)
 	mux.HandleFunc("/debug/liveness", cgh.Liveness)
@@ -104,11 +144,28 @@ func v1(app *web.App, cfg APIMuxConfig) {
 		Auth: cfg.Auth,
 	}
 
+	// Routes get a deadline that covers authentication and the queries they
+	// run. Exports stream the whole table so they are given longer, and
+	// the export extends the server's write timeout to match.
+	timeout := mid.Timeout(cfg.RequestTimeout)
+	exportTimeout := mid.Timeout(cfg.ExportTimeout)
+
+	// Authenticated clients are limited by subject, so the user routes take
+	// the limit after Authenticate. Tokens are requested without one, so
+	// clients are limited by address which keeps password guessing slow.
+	userLimit := mid.RateLimit(cfg.RateLimit, "users", cfg.UserRateLimit)
+	tokenLimit := mid.RateLimit(cfg.RateLimit, "token", cfg.TokenRateLimit)
+
+	// User documents are small, so writes don't need the app's body limit.
+	const userBodySize = 64 << 10
+
 	// [PS] support for extracting the parameter from the /path is added in foundation/web/request.go
-	app.Handle(http.MethodGet, version, "/users/token", ugh.Token)
-	app.Handle(http.MethodGet, version, "/users/:page/:rows", ugh.Query, mid.Authenticate(cfg.Auth), mid.Authorize(auth.RoleAdmin))
-	app.Handle(http.MethodGet, version, "/users/:id", ugh.QueryByID, mid.Authenticate(cfg.Auth))
-	app.Handle(http.MethodPost, version, "/users", ugh.Create, mid.Authenticate(cfg.Auth), mid.Authorize(auth.RoleAdmin))
-	app.Handle(http.MethodPut, version, "/users/:id", ugh.Update, mid.Authenticate(cfg.Auth), mid.Authorize(auth.RoleAdmin))
-	app.Handle(http.MethodDelete, version, "/users/:id", ugh.Delete, mid.Authenticate(cfg.Auth), mid.Authorize(auth.RoleAdmin))
+	app.Handle(http.MethodGet, version, "/users/token", ugh.Token, timeout, tokenLimit)
+	app.Handle(http.MethodGet, version, "/users/:page/:rows", ugh.Query, timeout, mid.Authenticate(cfg.Auth), userLimit, mid.Authorize(auth.RoleAdmin))
+	app.Handle(http.MethodGet, version, "/users/export", ugh.Export, exportTimeout, mid.Authenticate(cfg.Auth), userLimit, mid.Authorize(auth.RoleAdmin))
+	app.Handle(http.MethodGet, version, "/users/:id", ugh.QueryByID, timeout, mid.Authenticate(cfg.Auth), userLimit)
+	app.Handle(http.MethodPost, version, "/users", ugh.Create, timeout, web.MaxBodySize(userBodySize), mid.Authenticate(cfg.Auth), userLimit, mid.Authorize(auth.RoleAdmin))
+	app.Handle(http.MethodPut, version, "/users/:id", ugh.Update, timeout, web.MaxBodySize(userBodySize), mid.Authenticate(cfg.Auth), userLimit, mid.Authorize(auth.RoleAdmin))
+	app.Handle(http.MethodPatch, version, "/users/:id", ugh.Patch, timeout, web.MaxBodySize(userBodySize), mid.Authenticate(cfg.Auth), userLimit, mid.Authorize(auth.RoleAdmin))
+	app.Handle(http.MethodDelete, version, "/users/:id", ugh.Delete, timeout, mid.Authenticate(cfg.Auth), userLimit, mid.Authorize(auth.RoleAdmin))
 }
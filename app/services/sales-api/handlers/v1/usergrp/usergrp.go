@@ -5,8 +5,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	userCore "github.com/piyush-saurabh/go-service/business/core/user" // [PS] creating alias to prevent name clashing
 	"github.com/piyush-saurabh/go-service/business/data/store/user"
@@ -45,6 +49,36 @@ func (h Handlers) Query(ctx context.Context, w http.ResponseWriter, r *http.Requ
 	return web.Respond(ctx, w, users, http.StatusOK)
 }
 
+// exportGrace is the time left past the deadline of an export to send the
+// error response when the export times out.
+const exportGrace = time.Second
+
+// Export streams every user to the client as a JSON array or as NDJSON.
+func (h Handlers) Export(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	// The server's write timeout would cut the export short, so the write
+	// deadline follows the deadline of the route instead. Without one the
+	// export runs until the client goes away.
+	var deadline time.Time
+	if d, ok := ctx.Deadline(); ok {
+		deadline = d.Add(exportGrace)
+	}
+	if err := http.NewResponseController(w).SetWriteDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return fmt.Errorf("extending write deadline: %w", err)
+	}
+	stream := func(send func(v interface{}) error) error {
+		return h.User.QueryAll(ctx, func(usr user.User) error {
+			return send(usr)
+		})
+	}
+
+	if err := web.RespondStream(ctx, w, http.StatusOK, stream); err != nil {
+		return fmt.Errorf("exporting users: %w", err)
+	}
+
+	return nil
+}
+
 // QueryByID returns a user by its ID.
 func (h Handlers) QueryByID(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	claims, err := auth.GetClaims(ctx)
@@ -59,7 +93,7 @@ func (h Handlers) QueryByID(ctx context.Context, w http.ResponseWriter, r *http.
 		case database.ErrInvalidID:
 			return validate.NewRequestError(err, http.StatusBadRequest)
 		case database.ErrNotFound:
-			return validate.NewRequestError(err, http.StatusNotFound)
+			return validate.NewCodedRequestError(err, http.StatusNotFound, validate.CodeUserNotFound)
 		case database.ErrForbidden:
 			return validate.NewRequestError(err, http.StatusForbidden)
 		default:
@@ -67,6 +101,10 @@ func (h Handlers) QueryByID(ctx context.Context, w http.ResponseWriter, r *http.
 		}
 	}
 
+	// The ETag lets clients send the version they read back with If-Match
+	// when updating the user.
+	w.Header().Set("ETag", etag(usr.Version))
+
 	return web.Respond(ctx, w, usr, http.StatusOK)
 }
 
@@ -84,6 +122,9 @@ func (h Handlers) Create(ctx context.Context, w http.ResponseWriter, r *http.Req
 
 	usr, err := h.User.Create(ctx, nu, v.Now)
 	if err != nil {
+		if cerr, ok := validate.Cause(err).(*database.ConstraintError); ok {
+			return constraintError(cerr)
+		}
 		return fmt.Errorf("user[%+v]: %w", &usr, err)
 	}
 
@@ -107,15 +148,32 @@ func (h Handlers) Update(ctx context.Context, w http.ResponseWriter, r *http.Req
 		return fmt.Errorf("unable to decode payload: %w", err)
 	}
 
+	version, err := ifMatch(r)
+	if err != nil {
+		return validate.NewRequestError(err, http.StatusPreconditionFailed)
+	}
+	upd.Version = version
+
 	id := web.Param(r, "id")
 	if err := h.User.Update(ctx, claims, id, upd, v.Now); err != nil {
+		if cerr, ok := validate.Cause(err).(*database.ConstraintError); ok {
+			return constraintError(cerr)
+		}
 		switch validate.Cause(err) {
 		case database.ErrInvalidID:
 			return validate.NewRequestError(err, http.StatusBadRequest)
 		case database.ErrNotFound:
-			return validate.NewRequestError(err, http.StatusNotFound)
+			return validate.NewCodedRequestError(err, http.StatusNotFound, validate.CodeUserNotFound)
 		case database.ErrForbidden:
 			return validate.NewRequestError(err, http.StatusForbidden)
+		case database.ErrConflict:
+
+			// Without If-Match the conflict is with an update that landed
+			// while this one was being applied.
+			if version == nil {
+				return validate.NewRequestError(err, http.StatusConflict)
+			}
+			return validate.NewRequestError(err, http.StatusPreconditionFailed)
 		default:
 			return fmt.Errorf("ID[%s] User[%+v]: %w", id, &upd, err)
 		}
@@ -124,6 +182,69 @@ func (h Handlers) Update(ctx context.Context, w http.ResponseWriter, r *http.Req
 	return web.Respond(ctx, w, nil, http.StatusNoContent)
 }
 
+// Patch applies a JSON Merge Patch or JSON Patch document to a user.
+func (h Handlers) Patch(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, err := web.GetValues(ctx)
+	if err != nil {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, err := auth.GetClaims(ctx)
+	if err != nil {
+		return errors.New("claims missing from context")
+	}
+
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (contentType != web.ContentTypeMergePatch && contentType != web.ContentTypeJSONPatch) {
+		err := fmt.Errorf("content type must be %s or %s", web.ContentTypeMergePatch, web.ContentTypeJSONPatch)
+		return validate.NewRequestError(err, http.StatusUnsupportedMediaType)
+	}
+
+	doc, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("unable to read payload: %w", err)
+	}
+
+	version, err := ifMatch(r)
+	if err != nil {
+		return validate.NewRequestError(err, http.StatusPreconditionFailed)
+	}
+
+	p := user.Patch{
+		ContentType: contentType,
+		Document:    doc,
+		Version:     version,
+	}
+
+	id := web.Param(r, "id")
+	if err := h.User.Patch(ctx, claims, id, p, v.Now); err != nil {
+		if cerr, ok := validate.Cause(err).(*database.ConstraintError); ok {
+			return constraintError(cerr)
+		}
+		switch validate.Cause(err) {
+		case database.ErrInvalidID:
+			return validate.NewRequestError(err, http.StatusBadRequest)
+		case web.ErrInvalidPatch:
+			return validate.NewCodedRequestError(err, http.StatusBadRequest, validate.CodeInvalidPatch)
+		case database.ErrNotFound:
+			return validate.NewCodedRequestError(err, http.StatusNotFound, validate.CodeUserNotFound)
+		case database.ErrForbidden:
+			return validate.NewRequestError(err, http.StatusForbidden)
+		case web.ErrPatchTestFailed:
+			return validate.NewCodedRequestError(err, http.StatusConflict, validate.CodePatchTestFailed)
+		case database.ErrConflict:
+			if version == nil {
+				return validate.NewRequestError(err, http.StatusConflict)
+			}
+			return validate.NewRequestError(err, http.StatusPreconditionFailed)
+		default:
+			return fmt.Errorf("ID[%s]: %w", id, err)
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
 // Delete removes a user from the system.
 func (h Handlers) Delete(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	claims, err := auth.GetClaims(ctx)
@@ -137,7 +258,7 @@ func (h Handlers) Delete(ctx context.Context, w http.ResponseWriter, r *http.Req
 		case database.ErrInvalidID:
 			return validate.NewRequestError(err, http.StatusBadRequest)
 		case database.ErrNotFound:
-			return validate.NewRequestError(err, http.StatusNotFound)
+			return validate.NewCodedRequestError(err, http.StatusNotFound, validate.CodeUserNotFound)
 		case database.ErrForbidden:
 			return validate.NewRequestError(err, http.StatusForbidden)
 		default:
@@ -165,7 +286,7 @@ func (h Handlers) Token(ctx context.Context, w http.ResponseWriter, r *http.Requ
 	if err != nil {
 		switch validate.Cause(err) {
 		case database.ErrNotFound:
-			return validate.NewRequestError(err, http.StatusNotFound)
+			return validate.NewCodedRequestError(err, http.StatusNotFound, validate.CodeUserNotFound)
 		case database.ErrAuthenticationFailure:
 			return validate.NewRequestError(err, http.StatusUnauthorized)
 		default:
@@ -183,3 +304,59 @@ func (h Handlers) Token(ctx context.Context, w http.ResponseWriter, r *http.Requ
 
 	return web.Respond(ctx, w, tkn, http.StatusOK)
 }
+
+// constraintError converts a constraint violation into a request error that
+// points the client at the offending field. A duplicate is a conflict with an
+// existing user, anything else means the data can't be processed.
+func constraintError(err *database.ConstraintError) error {
+	status := http.StatusUnprocessableEntity
+	code := err.Code()
+	var msg string
+	switch err.Err {
+	case database.ErrDuplicate:
+		status = http.StatusConflict
+		msg = "is already in use"
+		if err.Column == "email" {
+			code = validate.CodeDuplicateEmail
+		}
+	case database.ErrReference:
+		msg = "refers to a record that does not exist"
+	case database.ErrNotNull:
+		msg = "is a required field"
+	default:
+		msg = "is not an allowed value"
+	}
+
+	var fields error
+	if err.Column != "" {
+		fields = validate.FieldErrors{{Field: err.Column, Error: err.Column + " " + msg}}
+	}
+
+	return &validate.RequestError{Err: err, Status: status, Fields: fields, Code: code}
+}
+
+// etag returns the entity tag for a version of a user.
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// ifMatch returns the version in the If-Match header of the request. Nil is
+// returned when the header is missing or is *, in which case the update isn't
+// tied to a version. Weak and multiple tags are not supported.
+func ifMatch(r *http.Request) (*int, error) {
+	tag := strings.TrimSpace(r.Header.Get("If-Match"))
+	if tag == "" || tag == "*" {
+		return nil, nil
+	}
+
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return nil, fmt.Errorf("invalid If-Match header [%s]", tag)
+	}
+
+	version, err := strconv.Atoi(tag[1 : len(tag)-1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid If-Match header [%s]", tag)
+	}
+
+	return &version, nil
+}
@@ -14,18 +14,23 @@ import (
 
 	"github.com/ardanlabs/conf"
 	"github.com/piyush-saurabh/go-service/app/services/sales-api/handlers"
+	"github.com/piyush-saurabh/go-service/business/data/schema"
 	"github.com/piyush-saurabh/go-service/business/sys/auth"
 	"github.com/piyush-saurabh/go-service/business/sys/database"
+	"github.com/piyush-saurabh/go-service/business/sys/ratelimit"
+	"github.com/piyush-saurabh/go-service/business/web/mid"
 	"github.com/piyush-saurabh/go-service/foundation/keystore"
 	"github.com/piyush-saurabh/go-service/foundation/logger"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/zipkin"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
 	"go.uber.org/automaxprocs/maxprocs"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 /*
@@ -38,14 +43,18 @@ var build = "develop"
 
 func main() {
 
-	log, err := logger.New("SALES-API")
+	// The level starts at info and is set from the configuration once it
+	// has been parsed. It can be changed at runtime through the debug service.
+	level := logger.NewLevel(zapcore.InfoLevel)
+
+	log, err := logger.NewWithLevel("SALES-API", level)
 	if err != nil {
 		fmt.Println((err))
 		os.Exit(1)
 	}
 
 	// Perform the startup and shutdown sequence
-	if err := run(log); err != nil {
+	if err := run(log, level); err != nil {
 		log.Errorw("startup", "ERROR", err)
 		os.Exit(1)
 	}
@@ -53,7 +62,7 @@ func main() {
 }
 
 // Run is called by main. It forwards all the error up to the main
-func run(log *zap.SugaredLogger) error {
+func run(log *zap.SugaredLogger, level *logger.Level) error {
 	// =========================================================================
 	// GOMAXPROCS
 
@@ -75,19 +84,60 @@ func run(log *zap.SugaredLogger) error {
 			WriteTimeout    time.Duration `conf:"default:10s"`
 			IdleTimeout     time.Duration `conf:"default:120s,mask"`   // mask this field e.g. token
 			ShutdownTimeout time.Duration `conf:"default:20s,noprint"` // prevent this field from getting logged e.g password
+			TrustedProxies  []string      // proxies allowed to set X-Forwarded-For e.g. 10.0.0.0/8;127.0.0.1
+			MaxBodySize     int64         `conf:"default:1048576"` // largest request body in bytes
+			CompressMinSize int           `conf:"default:1024"`    // smallest response body in bytes worth compressing
+			CompressLevel   int           `conf:"default:6"`       // gzip level from 1 (fastest) to 9 (smallest)
+			MaxInFlight     int           `conf:"default:1000"`    // requests handled at once before shedding with a 503
+			RequestTimeout  time.Duration `conf:"default:5s"`      // deadline for a route, below WriteTimeout
+			ExportTimeout   time.Duration `conf:"default:5m"`      // deadline for streaming exports, extends WriteTimeout
+		}
+		CORS struct {
+			AllowedOrigins   []string      // origins allowed to call the API e.g. https://example.com;https://*.example.com
+			AllowedMethods   []string      `conf:"default:GET;POST;PUT;PATCH;DELETE"`
+			AllowedHeaders   []string      `conf:"default:Authorization;Content-Type;If-Match;Accept"`
+			ExposedHeaders   []string      `conf:"default:ETag;RateLimit-Limit;RateLimit-Remaining;RateLimit-Reset;Retry-After"`
+			AllowCredentials bool          `conf:"default:false"`
+			MaxAge           time.Duration `conf:"default:1h"` // how long browsers cache preflight answers
+		}
+		RateLimit struct {
+			UserRate   float64 `conf:"default:10"`  // user requests per second per subject
+			UserBurst  int     `conf:"default:20"`  // user requests allowed at once
+			TokenRate  float64 `conf:"default:0.2"` // token requests per second per client address
+			TokenBurst int     `conf:"default:5"`   // token requests allowed at once
+		}
+		Log struct {
+			Level       string `conf:"default:info"`
+			SampleEvery int    `conf:"default:1"` // log 1 in N successful requests
 		}
 		Auth struct {
 			KeysFolder string `conf:"default:zarf/keys/"`
 			ActiveKID  string `conf:"default:54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"`
 		}
 		DB struct {
-			User         string `conf:"default:postgres"`
-			Password     string `conf:"default:postgres,mask"`
-			Host         string `conf:"default:localhost"`
-			Name         string `conf:"default:postgres"`
-			MaxIdleConns int    `conf:"default:0"`
-			MaxOpenConns int    `conf:"default:0"`
-			DisableTLS   bool   `conf:"default:true"`
+			User             string `conf:"default:postgres"`
+			Password         string `conf:"default:postgres,mask"`
+			Host             string `conf:"default:localhost"`
+			Name             string `conf:"default:postgres"`
+			MaxIdleConns     int    `conf:"default:0"`
+			MaxOpenConns     int    `conf:"default:0"`
+			DisableTLS       bool   `conf:"default:true"`
+			Port             int    // added to Host when it has no port
+			TLSMode          string // disable, require, verify-ca or verify-full, overrides DisableTLS
+			CACertFile       string // CA bundle used to verify the server
+			CertFile         string // client certificate
+			KeyFile          string // client certificate key
+			SearchPath       string
+			ApplicationName  string        `conf:"default:sales-api"`
+			ConnectTimeout   time.Duration `conf:"default:5s"`
+			StatementTimeout time.Duration // zero means no limit
+			DeadlineTimeout  bool          `conf:"default:false"` // limit statements to the request deadline
+			MigrateOnStart   bool          `conf:"default:false"` // opt-in to running migrations when the service starts
+			MigrateTimeout   time.Duration `conf:"default:5m"`
+			Replicas         []string      // read replica hosts or URLs e.g. replica-1;replica-2
+			ReplicaRetry     time.Duration `conf:"default:30s"` // how long a failed replica is skipped
+			BreakerThreshold int           `conf:"default:5"`   // consecutive connection failures that open the circuit
+			BreakerCooldown  time.Duration `conf:"default:10s"` // how long the circuit stays open before probing
 		}
 		Zipkin struct {
 			ReporterURI string  `conf:"default:http://localhost:9411/api/v2/spans"`
@@ -112,6 +162,13 @@ func run(log *zap.SugaredLogger) error {
 		return fmt.Errorf("parsing config: %w", err)
 	}
 
+	// Apply the configured log level.
+	var lvl zapcore.Level
+	if err := lvl.UnmarshalText([]byte(cfg.Log.Level)); err != nil {
+		return fmt.Errorf("parsing log level: %w", err)
+	}
+	level.SetLevel(lvl)
+
 	// =========================================================================
 	// App Starting
 
@@ -148,9 +205,9 @@ func run(log *zap.SugaredLogger) error {
 	// Database Support
 
 	// Create connectivity to the database.
-	log.Infow("startup", "status", "initializing database support", "host", cfg.DB.Host)
+	log.Infow("startup", "status", "initializing database support", "host", cfg.DB.Host, "replicas", len(cfg.DB.Replicas))
 
-	db, err := database.Open(database.Config{
+	db, err := database.OpenDB(database.Config{
 		User:         cfg.DB.User,
 		Password:     cfg.DB.Password,
 		Host:         cfg.DB.Host,
@@ -158,6 +215,24 @@ func run(log *zap.SugaredLogger) error {
 		MaxIdleConns: cfg.DB.MaxIdleConns,
 		MaxOpenConns: cfg.DB.MaxOpenConns,
 		DisableTLS:   cfg.DB.DisableTLS,
+		Port:         cfg.DB.Port,
+
+		TLSMode:    cfg.DB.TLSMode,
+		CACertFile: cfg.DB.CACertFile,
+		CertFile:   cfg.DB.CertFile,
+		KeyFile:    cfg.DB.KeyFile,
+
+		SearchPath:       cfg.DB.SearchPath,
+		ApplicationName:  cfg.DB.ApplicationName,
+		ConnectTimeout:   cfg.DB.ConnectTimeout,
+		StatementTimeout: cfg.DB.StatementTimeout,
+		DeadlineTimeout:  cfg.DB.DeadlineTimeout,
+
+		Replicas:     cfg.DB.Replicas,
+		ReplicaRetry: cfg.DB.ReplicaRetry,
+
+		BreakerThreshold: cfg.DB.BreakerThreshold,
+		BreakerCooldown:  cfg.DB.BreakerCooldown,
 	})
 	if err != nil {
 		return fmt.Errorf("connecting to db: %w", err)
@@ -182,6 +257,34 @@ func run(log *zap.SugaredLogger) error {
 	}
 	defer traceProvider.Shutdown(context.Background())
 
+	// =========================================================================
+	// Startup Migrations
+
+	// Migrations run in the background so the debug service can report the
+	// service as not ready until they are done. An advisory lock makes sure
+	// only one replica applies them.
+	var migrated chan struct{}
+	migrateErrors := make(chan error, 1)
+
+	if cfg.DB.MigrateOnStart {
+		migrated = make(chan struct{})
+
+		go func() {
+			log.Infow("startup", "status", "running migrations", "host", cfg.DB.Host)
+
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.DB.MigrateTimeout)
+			defer cancel()
+
+			if err := schema.MigrateLocked(ctx, db.DB); err != nil {
+				migrateErrors <- err
+				return
+			}
+
+			log.Infow("startup", "status", "migrations complete")
+			close(migrated)
+		}()
+	}
+
 	// =========================================================================
 	// Start Debug Service
 
@@ -191,7 +294,7 @@ func run(log *zap.SugaredLogger) error {
 	// related endpoints. This include the standard library endpoints.
 
 	// Construct the mux for the debug calls.
-	debugMux := handlers.DebugMux(build, log, db)
+	debugMux := handlers.DebugMux(build, log, db, level, migrated)
 
 	// Start the service listening for debug requests.
 	// Not concerned with shutting this down with load shedding.
@@ -211,12 +314,55 @@ func run(log *zap.SugaredLogger) error {
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM)
 
+	trustedProxies, err := mid.ParseTrustedProxies(cfg.Web.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("parsing trusted proxies: %w", err)
+	}
+
+	corsCfg := mid.CORSConfig{
+		AllowedOrigins:   cfg.CORS.AllowedOrigins,
+		AllowedMethods:   cfg.CORS.AllowedMethods,
+		AllowedHeaders:   cfg.CORS.AllowedHeaders,
+		ExposedHeaders:   cfg.CORS.ExposedHeaders,
+		AllowCredentials: cfg.CORS.AllowCredentials,
+		MaxAge:           cfg.CORS.MaxAge,
+	}
+	if err := corsCfg.Validate(); err != nil {
+		return fmt.Errorf("validating cors config: %w", err)
+	}
+
 	// Construct the mux for the API calls.
 	apiMux := handlers.APIMux(handlers.APIMuxConfig{
 		Shutdown: shutdown,
 		Log:      log,
-		Auth:     auth,
-		DB:       db,
+		LogLevel: level,
+		Logger: mid.LoggerConfig{
+			TrustedProxies: trustedProxies,
+			SampleEvery:    cfg.Log.SampleEvery,
+		},
+		Compress: mid.CompressConfig{
+			MinSize: cfg.Web.CompressMinSize,
+			Level:   cfg.Web.CompressLevel,
+		},
+		CORS: corsCfg,
+		RateLimit: mid.RateLimitConfig{
+			Store:          ratelimit.NewMemory(),
+			TrustedProxies: trustedProxies,
+		},
+		Auth:        auth,
+		DB:          db,
+		MaxBodySize: cfg.Web.MaxBodySize,
+		UserRateLimit: ratelimit.Limit{
+			Rate:  cfg.RateLimit.UserRate,
+			Burst: cfg.RateLimit.UserBurst,
+		},
+		TokenRateLimit: ratelimit.Limit{
+			Rate:  cfg.RateLimit.TokenRate,
+			Burst: cfg.RateLimit.TokenBurst,
+		},
+		MaxInFlight:    cfg.Web.MaxInFlight,
+		RequestTimeout: cfg.Web.RequestTimeout,
+		ExportTimeout:  cfg.Web.ExportTimeout,
 	})
 
 	// Construct a server to service the requests against the mux.
@@ -248,6 +394,10 @@ func run(log *zap.SugaredLogger) error {
 	case err := <-serverErrors:
 		return fmt.Errorf("server error: %w", err)
 
+	// migrations failed so the service can't run against this database
+	case err := <-migrateErrors:
+		return fmt.Errorf("migrating database: %w", err)
+
 	// on press of ctrl+c / k8s brings the service down
 	case sig := <-shutdown:
 		log.Infow("shutdown", "status", "shutdown started", "signal", sig)
@@ -303,6 +453,10 @@ func startTracing(serviceName string, reporterURI string, probability float64) (
 
 	// I can only get this working properly using the singleton :(
 	otel.SetTracerProvider(traceProvider)
+
+	// Use the W3C TraceContext standard for extracting the traceparent from
+	// incoming requests and injecting it into outbound calls.
+	otel.SetTextMapPropagator(propagation.TraceContext{})
 	return traceProvider, nil
 }
 
@@ -14,6 +14,7 @@ import (
 	"github.com/piyush-saurabh/go-service/business/data/store/user"
 	"github.com/piyush-saurabh/go-service/business/data/tests"
 	"github.com/piyush-saurabh/go-service/business/sys/auth"
+	"github.com/piyush-saurabh/go-service/business/sys/validate"
 )
 
 // [PS] This will hold the methods of all the tests we want to execute
@@ -57,7 +58,9 @@ func TestUsers(t *testing.T) {
 	//t.Run("postUser400", tests.postUser400) // Commented due to missing package: cmpopts
 	t.Run("postUser401", tests.postUser401)
 	t.Run("postUser403", tests.postUser403)
+	t.Run("postUser409", tests.postUser409)
 	t.Run("getUser400", tests.getUser400)
+	t.Run("getUser400Problem", tests.getUser400Problem)
 	t.Run("getUser403", tests.getUser403)
 	t.Run("getUser404", tests.getUser404)
 	t.Run("deleteUserNotFound", tests.deleteUserNotFound)
@@ -200,6 +203,55 @@ func (ut *UserTests) postUser403(t *testing.T) {
 	}
 }
 
+// postUser409 validates a user can't be created with an email that is
+// already in use.
+func (ut *UserTests) postUser409(t *testing.T) {
+	nu := user.NewUser{
+		Name:            "Admin Gopher",
+		Email:           "admin@example.com",
+		Roles:           []string{auth.RoleAdmin},
+		Password:        "gophers",
+		PasswordConfirm: "gophers",
+	}
+
+	body, err := json.Marshal(&nu)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/users", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+ut.adminToken)
+	ut.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to validate a new user can't reuse an email.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using the email of an existing user.", testID)
+		{
+			if w.Code != http.StatusConflict {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 409 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 409 for the response.", tests.Success, testID)
+
+			var got validate.ErrorResponse
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response to an error type : %v", tests.Failed, testID, err)
+			}
+			if !strings.Contains(got.Fields, `"field":"email"`) {
+				t.Fatalf("\t%s\tTest %d:\tShould get the email field in the error : %s", tests.Failed, testID, got.Fields)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the email field in the error.", tests.Success, testID)
+
+			if got.Code != validate.CodeDuplicateEmail {
+				t.Fatalf("\t%s\tTest %d:\tShould get the %s code : %s", tests.Failed, testID, validate.CodeDuplicateEmail, got.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the %s code.", tests.Success, testID, validate.CodeDuplicateEmail)
+		}
+	}
+}
+
 // postUser401 validates a user can't be created unless the calling user is
 // authenticated.
 func (ut *UserTests) postUser401(t *testing.T) {
@@ -248,7 +300,7 @@ func (ut *UserTests) getUser400(t *testing.T) {
 			t.Logf("\t%s\tTest %d:\tShould receive a status code of 400 for the response.", tests.Success, testID)
 
 			got := w.Body.String()
-			exp := `{"error":"query: ID is not in its proper form"}`
+			exp := `{"error":"query: ID is not in its proper form","code":"INVALID_ID"}`
 			if got != exp {
 				t.Logf("\t\tTest %d:\tGot : %v", testID, got)
 				t.Logf("\t\tTest %d:\tExp: %v", testID, exp)
@@ -259,6 +311,49 @@ func (ut *UserTests) getUser400(t *testing.T) {
 	}
 }
 
+// getUser400Problem validates the error is an RFC 7807 document when the
+// client accepts problem+json.
+func (ut *UserTests) getUser400Problem(t *testing.T) {
+	id := "12345"
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/users/"+id, nil)
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+ut.adminToken)
+	r.Header.Set("Accept", "application/problem+json")
+	ut.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to get errors in the problem+json form.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using the new user %s.", testID, id)
+		{
+			if ct := w.Header().Get("Content-Type"); ct != validate.ContentTypeProblem {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a problem+json response : %v", tests.Failed, testID, ct)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a problem+json response.", tests.Success, testID)
+
+			var got validate.Problem
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response to a problem : %v", tests.Failed, testID, err)
+			}
+
+			exp := validate.Problem{
+				Type:     "about:blank",
+				Title:    http.StatusText(http.StatusBadRequest),
+				Status:   http.StatusBadRequest,
+				Detail:   "query: ID is not in its proper form",
+				Instance: got.Instance,
+				Code:     validate.CodeInvalidID,
+			}
+			if diff := cmp.Diff(got, exp); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get the expected problem. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the expected problem.", tests.Success, testID)
+		}
+	}
+}
+
 // getUser403 validates a regular user can't fetch anyone but themselves.
 func (ut *UserTests) getUser403(t *testing.T) {
 	t.Log("Given the need to validate regular users can't fetch other users.")
@@ -0,0 +1,25 @@
+package commands
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/piyush-saurabh/go-service/business/sys/validate"
+)
+
+// ErrorCodes prints the registry of error codes returned by the API as a
+// markdown table, which is how zarf/docs/error-codes.md is generated.
+func ErrorCodes() error {
+	fmt.Println("# Error Codes")
+	fmt.Println()
+	fmt.Println("Every error response carries a `code` that clients can branch on. This file")
+	fmt.Println("is generated by `make error-codes`, don't edit it by hand.")
+	fmt.Println()
+	fmt.Println("| Code | Status | Description |")
+	fmt.Println("|------|--------|-------------|")
+	for _, ci := range validate.Codes() {
+		fmt.Printf("| `%s` | %d %s | %s |\n", ci.Code, ci.Status, http.StatusText(ci.Status), ci.Description)
+	}
+
+	return nil
+}
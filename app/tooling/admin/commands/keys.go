@@ -0,0 +1,27 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/piyush-saurabh/go-service/foundation/keystore"
+)
+
+// KeysList prints the key ids found in the keys folder and marks the one
+// used to sign new tokens.
+func KeysList(keysFolder string, activeKID string) error {
+	ks, err := keystore.NewFS(os.DirFS(keysFolder))
+	if err != nil {
+		return fmt.Errorf("reading keys: %w", err)
+	}
+
+	for _, kid := range ks.KIDs() {
+		marker := " "
+		if kid == activeKID {
+			marker = "*"
+		}
+		fmt.Printf("%s %s\n", marker, kid)
+	}
+
+	return nil
+}
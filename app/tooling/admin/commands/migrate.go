@@ -0,0 +1,158 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/piyush-saurabh/go-service/business/data/schema"
+	"github.com/piyush-saurabh/go-service/business/sys/database"
+)
+
+// Migrate creates the schema in the database.
+func Migrate(cfg database.Config) error {
+	db, err := database.Open(cfg)
+	if err != nil {
+		return fmt.Errorf("connect database: %w", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := schema.Migrate(ctx, db); err != nil {
+		return fmt.Errorf("migrate database: %w", err)
+	}
+
+	fmt.Println("migrations complete")
+	return nil
+}
+
+// MigrateStatus shows which migrations have been applied and flags the ones
+// that were modified after being applied.
+func MigrateStatus(cfg database.Config) error {
+	db, err := database.Open(cfg)
+	if err != nil {
+		return fmt.Errorf("connect database: %w", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	statuses, err := schema.Status(ctx, db)
+	if err != nil {
+		return fmt.Errorf("migration status: %w", err)
+	}
+
+	var modified bool
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tSTATUS\tAPPLIED AT\tCHECKSUM\tDESCRIPTION")
+	for _, s := range statuses {
+		status := "pending"
+		appliedAt := "-"
+		switch {
+		case s.Removed:
+			status = "removed"
+		case s.Modified:
+			status = "MODIFIED"
+			modified = true
+		case s.Applied:
+			status = "applied"
+		}
+		if s.Applied {
+			appliedAt = s.AppliedAt.UTC().Format(time.RFC3339)
+		}
+
+		checksum := s.Checksum
+		if s.Applied {
+			checksum = s.AppliedChecksum
+		}
+
+		fmt.Fprintf(tw, "%v\t%s\t%s\t%s\t%s\n", float32(s.Version), status, appliedAt, checksum, s.Description)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if modified {
+		return fmt.Errorf("migrate status: %w", schema.ErrModified)
+	}
+	return nil
+}
+
+// MigrateDryRun prints the SQL of the migrations that would be applied.
+func MigrateDryRun(cfg database.Config) error {
+	db, err := database.Open(cfg)
+	if err != nil {
+		return fmt.Errorf("connect database: %w", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pending, err := schema.Pending(ctx, db)
+	if err != nil {
+		return fmt.Errorf("pending migrations: %w", err)
+	}
+
+	if len(pending) == 0 {
+		fmt.Println("no pending migrations")
+		return nil
+	}
+
+	for _, mig := range pending {
+		fmt.Printf("-- Version: %v\n-- Description: %s\n%s\n", mig.Version, mig.Description, mig.Up)
+	}
+	return nil
+}
+
+// MigrateDown rolls the schema back to the target version by running the down
+// scripts of the migrations applied after it. With dryRun set the SQL is only
+// printed.
+func MigrateDown(cfg database.Config, target string, dryRun bool) error {
+	if target == "" {
+		fmt.Println("help: migrate down <version> [dry-run]")
+		return ErrHelp
+	}
+
+	version, err := strconv.ParseFloat(target, 64)
+	if err != nil {
+		return fmt.Errorf("invalid version format [%s]", target)
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return fmt.Errorf("connect database: %w", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if dryRun {
+		plan, err := schema.RollbackPlan(ctx, db, version)
+		if err != nil {
+			return fmt.Errorf("rollback plan: %w", err)
+		}
+		if len(plan) == 0 {
+			fmt.Println("nothing to roll back")
+			return nil
+		}
+		for _, mig := range plan {
+			fmt.Printf("-- Version: %v\n-- Description: %s\n%s\n", mig.Version, mig.Description, mig.Down)
+		}
+		return nil
+	}
+
+	if err := schema.Rollback(ctx, db, version); err != nil {
+		return fmt.Errorf("rollback database: %w", err)
+	}
+
+	fmt.Printf("rolled back to version %v\n", version)
+	return nil
+}
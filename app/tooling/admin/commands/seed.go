@@ -0,0 +1,121 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/piyush-saurabh/go-service/business/data/schema"
+	"github.com/piyush-saurabh/go-service/business/sys/database"
+	"github.com/piyush-saurabh/go-service/foundation/logger"
+)
+
+// Seed loads the named seed set into the database. The volumes of the set
+// can be overridden, an empty value keeps the volume of the set.
+func Seed(cfg database.Config, name string, users string, products string, sales string) error {
+	if name == "" {
+		name = schema.SeedTest.Name
+	}
+
+	set, err := schema.LookupSeedSet(name)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range []struct {
+		arg   string
+		value *int
+		name  string
+	}{
+		{users, &set.Users, "users"},
+		{products, &set.Products, "products"},
+		{sales, &set.Sales, "sales"},
+	} {
+		if v.arg == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v.arg)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid %s format [%s]", v.name, v.arg)
+		}
+		*v.value = n
+	}
+
+	log, err := logger.New("ADMIN")
+	if err != nil {
+		return fmt.Errorf("constructing logger: %w", err)
+	}
+	defer log.Sync()
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return fmt.Errorf("connect database: %w", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if err := schema.Seed(ctx, log, db, set); err != nil {
+		return fmt.Errorf("seed database: %w", err)
+	}
+
+	fmt.Printf("seed data complete: set[%s] users[%d] products[%d] sales[%d]\n", set.Name, set.Users, set.Products, set.Sales)
+	return nil
+}
+
+// DeleteAll removes all the data from the database.
+func DeleteAll(cfg database.Config) error {
+	log, err := logger.New("ADMIN")
+	if err != nil {
+		return fmt.Errorf("constructing logger: %w", err)
+	}
+	defer log.Sync()
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return fmt.Errorf("connect database: %w", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := schema.DeleteAll(ctx, log, db); err != nil {
+		return fmt.Errorf("delete data: %w", err)
+	}
+
+	fmt.Println("delete data complete")
+	return nil
+}
+
+// Env shows the environment the database is flagged as, or flags it as the
+// specified environment.
+func Env(cfg database.Config, env string) error {
+	db, err := database.Open(cfg)
+	if err != nil {
+		return fmt.Errorf("connect database: %w", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if env != "" {
+		if err := schema.SetEnvironment(ctx, db, env); err != nil {
+			return err
+		}
+	}
+
+	current, err := schema.Environment(ctx, db)
+	if err != nil {
+		return err
+	}
+	if current == "" {
+		current = "(not set)"
+	}
+
+	fmt.Println("environment:", current)
+	return nil
+}
@@ -0,0 +1,126 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	userCore "github.com/piyush-saurabh/go-service/business/core/user"
+	"github.com/piyush-saurabh/go-service/business/data/store/user"
+	"github.com/piyush-saurabh/go-service/business/sys/auth"
+	"github.com/piyush-saurabh/go-service/business/sys/database"
+	"go.uber.org/zap"
+)
+
+// adminClaims are used for the calls into the business layer that require the
+// caller to be an admin. The tool is run by an operator with database access.
+var adminClaims = auth.Claims{Roles: []string{auth.RoleAdmin}}
+
+// UserCreate adds a new user into the database.
+func UserCreate(log *zap.SugaredLogger, cfg database.Config, name, email, password, roles string) error {
+	if name == "" || email == "" || password == "" {
+		fmt.Println("help: users create <name> <email> <password> [roles]")
+		return ErrHelp
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return fmt.Errorf("connect database: %w", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	nu := user.NewUser{
+		Name:            name,
+		Email:           email,
+		Password:        password,
+		PasswordConfirm: password,
+		Roles:           parseRoles(roles),
+	}
+
+	core := userCore.NewCore(log, db)
+	usr, err := core.Create(ctx, nu, time.Now())
+	if err != nil {
+		return fmt.Errorf("create user: %w", err)
+	}
+
+	fmt.Println("user id:", usr.ID)
+	return nil
+}
+
+// UserList prints a page of users from the database.
+func UserList(log *zap.SugaredLogger, cfg database.Config, pageNumber int, rowsPerPage int) error {
+	db, err := database.Open(cfg)
+	if err != nil {
+		return fmt.Errorf("connect database: %w", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	core := userCore.NewCore(log, db)
+	users, err := core.Query(ctx, pageNumber, rowsPerPage)
+	if err != nil {
+		return fmt.Errorf("query users: %w", err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tEMAIL\tROLES\tUPDATED")
+	for _, usr := range users {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", usr.ID, usr.Name, usr.Email,
+			strings.Join(usr.Roles, ","), usr.DateUpdated.Format(time.RFC3339))
+	}
+
+	return tw.Flush()
+}
+
+// UserSetRoles replaces the roles of an existing user.
+func UserSetRoles(log *zap.SugaredLogger, cfg database.Config, userID string, roles string) error {
+	if userID == "" || roles == "" {
+		fmt.Println("help: users set-roles <user_id> <roles>")
+		return ErrHelp
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return fmt.Errorf("connect database: %w", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	uu := user.UpdateUser{
+		Roles: parseRoles(roles),
+	}
+
+	core := userCore.NewCore(log, db)
+	if err := core.Update(ctx, adminClaims, userID, uu, time.Now()); err != nil {
+		return fmt.Errorf("update user: %w", err)
+	}
+
+	fmt.Println("roles updated")
+	return nil
+}
+
+// parseRoles converts a comma separated list of roles. The USER role is used
+// when no roles are provided.
+func parseRoles(roles string) []string {
+	if roles == "" {
+		return []string{auth.RoleUser}
+	}
+
+	var list []string
+	for _, role := range strings.Split(roles, ",") {
+		if role = strings.ToUpper(strings.TrimSpace(role)); role != "" {
+			list = append(list, role)
+		}
+	}
+	return list
+}
@@ -1,280 +1,210 @@
+// This program performs administrative tasks for the sales service.
 package main
 
 import (
-	"context"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
 	"errors"
 	"fmt"
-	"io"
 	"os"
-	"time"
+	"strconv"
 
-	"github.com/golang-jwt/jwt/v4"
-	"github.com/piyush-saurabh/go-service/business/data/schema"
+	"github.com/ardanlabs/conf"
+	"github.com/piyush-saurabh/go-service/app/tooling/admin/commands"
 	"github.com/piyush-saurabh/go-service/business/sys/database"
+	"github.com/piyush-saurabh/go-service/foundation/logger"
+	"go.uber.org/zap"
 )
 
+// build is the git version of this program. It is set using build flags in the makefile.
+var build = "develop"
+
 func main() {
 
-	//err := GenKey() // Generate public private key pair
-	//err := GenToken() // Generate signed jwt using private key
-	err := migrate() // migration of database
+	// Construct the application logger.
+	log, err := logger.New("ADMIN")
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
-}
-
-// [PS] create the tables and support for migrations
-func migrate() error {
-	cfg := database.Config{
-		User:         "postgres",
-		Password:     "postgres",
-		Host:         "localhost",
-		Name:         "postgres",
-		MaxIdleConns: 0,
-		MaxOpenConns: 0,
-		DisableTLS:   true,
-	}
-
-	db, err := database.Open(cfg)
-
-	if err != nil {
-		return fmt.Errorf("connect database: %w", err)
-	}
-	defer db.Close()
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	if err := schema.Migrate(ctx, db); err != nil {
-		return fmt.Errorf("migrate database: %w", err)
-	}
-
-	fmt.Println("migrations complete")
-
-	// Seed the data after migration
-	return seed()
-}
-
-// [PS] create the tables and support for migrations
-func seed() error {
-	cfg := database.Config{
-		User:         "postgres",
-		Password:     "postgres",
-		Host:         "localhost",
-		Name:         "postgres",
-		MaxIdleConns: 0,
-		MaxOpenConns: 0,
-		DisableTLS:   true,
-	}
-
-	db, err := database.Open(cfg)
-	if err != nil {
-		return fmt.Errorf("connect database: %w", err)
-	}
-	defer db.Close()
+	defer log.Sync()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	if err := schema.Seed(ctx, db); err != nil {
-		return fmt.Errorf("seed database: %w", err)
+	// Perform the startup and shutdown sequence.
+	if err := run(log); err != nil {
+		if !errors.Is(err, commands.ErrHelp) {
+			fmt.Println("ERROR", err)
+		}
+		os.Exit(1)
 	}
-
-	fmt.Println("seed data complete")
-	return nil
 }
 
-// GenToken generates a JWT for the specified user.
-func GenToken() error {
-
-	// ===============================================================
-	// Read the private key
-	path := "zarf/keys/54bb2165-71e1-41a6-af3e-7da4a0e1e2c1.pem"
-	file, err := os.Open(path)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
+func run(log *zap.SugaredLogger) error {
 
-	privatePEM, err := io.ReadAll(io.LimitReader(file, 1024*1024))
-	if err != nil {
-		return fmt.Errorf("reading auth private key: %w", err)
-	}
+	// =========================================================================
+	// Configuration
 
-	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privatePEM)
-	if err != nil {
-		return fmt.Errorf("parsing auth private key: %w", err)
-	}
-
-	// ===============================================================
-
-	// Generating a token requires defining a set of claims. In this applications
-	// case, we only care about defining the subject and the user in question and
-	// the roles they have on the database. This token will expire in a year.
-	//
-	// iss (issuer): Issuer of the JWT
-	// sub (subject): Subject of the JWT (the user)
-	// aud (audience): Recipient for which the JWT is intended
-	// exp (expiration time): Time after which the JWT expires
-	// nbf (not before time): Time before which the JWT must not be accepted for processing
-	// iat (issued at time): Time at which the JWT was issued; can be used to determine age of the JWT
-	// jti (JWT ID): Unique identifier; can be used to prevent the JWT from being replayed (allows a token to be used only once)
-
-	claims := struct {
-		jwt.StandardClaims
-		Roles []string
+	// The configuration mirrors sales-api so the same SALES_ environment
+	// variables point the tool at the same environment.
+	cfg := struct {
+		conf.Version
+		Args conf.Args
+		Auth struct {
+			KeysFolder string `conf:"default:zarf/keys/"`
+			ActiveKID  string `conf:"default:54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"`
+		}
+		DB struct {
+			User         string `conf:"default:postgres"`
+			Password     string `conf:"default:postgres,mask"`
+			Host         string `conf:"default:localhost"`
+			Name         string `conf:"default:postgres"`
+			MaxIdleConns int    `conf:"default:0"`
+			MaxOpenConns int    `conf:"default:0"`
+			DisableTLS   bool   `conf:"default:true"`
+			Port         int
+			TLSMode      string
+			CACertFile   string
+			CertFile     string
+			KeyFile      string
+			SearchPath   string
+		}
 	}{
-		StandardClaims: jwt.StandardClaims{
-			Subject:   "user-id-123",
-			Issuer:    "service project",
-			ExpiresAt: time.Now().Add(8760 * time.Hour).Unix(),
-			IssuedAt:  time.Now().Unix(),
+		Version: conf.Version{
+			SVN:  build,
+			Desc: "copyright information here",
 		},
-		Roles: []string{"ADMIN"},
 	}
 
-	method := jwt.GetSigningMethod("RS256")
-	token := jwt.NewWithClaims(method, claims)
-
-	// Add header section in the token
-	// kid tells which public key was used to sign the token. If the key is rotated, we can expire the token
-	token.Header["kid"] = "54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"
-
-	// Sign the jwt using private key
-	signedJwt, err := token.SignedString(privateKey)
+	const prefix = "SALES"
+	help, err := conf.ParseOSArgs(prefix, &cfg)
 	if err != nil {
-		return err
-	}
-
-	fmt.Println("=========JWT TOKEN BEGIN=========")
-	fmt.Println(signedJwt)
-	fmt.Println("=========JWT TOKEN END=========")
-	fmt.Print("\n")
-
-	// ===============================================================
-
-	// Dump the public key from the private key for token verification
+		if errors.Is(err, conf.ErrHelpWanted) {
+			fmt.Println(help)
+			printCommands()
+			return nil
+		}
+		return fmt.Errorf("parsing config: %w", err)
+	}
+
+	// =========================================================================
+	// Commands
+
+	dbConfig := database.Config{
+		User:         cfg.DB.User,
+		Password:     cfg.DB.Password,
+		Host:         cfg.DB.Host,
+		Name:         cfg.DB.Name,
+		MaxIdleConns: cfg.DB.MaxIdleConns,
+		MaxOpenConns: cfg.DB.MaxOpenConns,
+		DisableTLS:   cfg.DB.DisableTLS,
+		Port:         cfg.DB.Port,
+		TLSMode:      cfg.DB.TLSMode,
+		CACertFile:   cfg.DB.CACertFile,
+		CertFile:     cfg.DB.CertFile,
+		KeyFile:      cfg.DB.KeyFile,
+		SearchPath:   cfg.DB.SearchPath,
+
+		ApplicationName: "sales-admin",
+	}
+
+	args := cfg.Args
+	switch args.Num(0) {
+	case "migrate":
+		switch args.Num(1) {
+		case "", "up":
+			return commands.Migrate(dbConfig)
+		case "status":
+			return commands.MigrateStatus(dbConfig)
+		case "dry-run":
+			return commands.MigrateDryRun(dbConfig)
+		case "down":
+			return commands.MigrateDown(dbConfig, args.Num(2), args.Num(3) == "dry-run")
+		}
 
-	// Marshal the public key from the private key to PKIX.
-	asn1Bytes, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
-	if err != nil {
-		return fmt.Errorf("marshaling public key: %w", err)
-	}
+	case "seed":
+		return commands.Seed(dbConfig, args.Num(1), args.Num(2), args.Num(3), args.Num(4))
 
-	// Construct a PEM block for the public key.
-	publicBlock := pem.Block{
-		Type:  "RSA PUBLIC KEY",
-		Bytes: asn1Bytes,
-	}
+	case "delete-all":
+		return commands.DeleteAll(dbConfig)
 
-	// Write the public key to the private key file.
-	if err := pem.Encode(os.Stdout, &publicBlock); err != nil {
-		return fmt.Errorf("encoding to public file: %w", err)
-	}
+	case "env":
+		return commands.Env(dbConfig, args.Num(1))
 
-	// ===============================================================
+	case "error-codes":
+		return commands.ErrorCodes()
 
-	// Validate Token
+	case "genkey":
+		return commands.GenKey(cfg.Auth.KeysFolder)
 
-	// Create the token parser to use. The algorithm used to sign the JWT must be
-	// validated to avoid a critical vulnerability:
-	// https://auth0.com/blog/critical-vulnerabilities-in-json-web-token-libraries/
-	parser := jwt.Parser{
-		ValidMethods: []string{"RS256"},
-	}
-
-	var parsedClaims struct {
-		jwt.StandardClaims
-		Roles []string
-	}
-
-	keyFunc := func(t *jwt.Token) (interface{}, error) {
-		kid, ok := t.Header["kid"]
-		if !ok {
-			return nil, errors.New("missing key id (kid) in token header")
+	case "gentoken":
+		kid := args.Num(2)
+		if kid == "" {
+			kid = cfg.Auth.ActiveKID
 		}
-		kidID, ok := kid.(string)
-		if !ok {
-			return nil, errors.New("user token key id (kid) must be string")
+		return commands.GenToken(log, dbConfig, cfg.Auth.KeysFolder, kid, args.Num(1))
+
+	case "users":
+		switch args.Num(1) {
+		case "create":
+			return commands.UserCreate(log, dbConfig, args.Num(2), args.Num(3), args.Num(4), args.Num(5))
+
+		case "list":
+			page, rows, err := paging(args.Num(2), args.Num(3))
+			if err != nil {
+				return err
+			}
+			return commands.UserList(log, dbConfig, page, rows)
+
+		case "set-roles":
+			return commands.UserSetRoles(log, dbConfig, args.Num(2), args.Num(3))
 		}
-		fmt.Println("KID: ", kidID)
-		return &privateKey.PublicKey, nil
-	}
 
-	parsedToken, err := parser.ParseWithClaims(signedJwt, &parsedClaims, keyFunc)
-	if err != nil {
-		return fmt.Errorf("parsing token: %w", err)
-	}
-
-	// Create the token parser to use. The algorithm used to sign the JWT must be
-	// validated to avoid a critical vulnerability:
-	// https://auth0.com/blog/critical-vulnerabilities-in-json-web-token-libraries/
-	if !parsedToken.Valid {
-		return errors.New("invalid token")
+	case "keys":
+		switch args.Num(1) {
+		case "list":
+			return commands.KeysList(cfg.Auth.KeysFolder, cfg.Auth.ActiveKID)
+		}
 	}
 
-	fmt.Println("==================")
-	fmt.Println("Token is valid")
-
-	return nil
+	printCommands()
+	return commands.ErrHelp
 }
 
-/// GenKey creates an x509 private/public key for auth tokens.
-func GenKey() error {
-
-	// Generate a new private key.
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		return err
-	}
-
-	// Create a file for the private key information in PEM form.
-	privateFile, err := os.Create("private.pem")
-	if err != nil {
-		return fmt.Errorf("creating private file: %w", err)
-	}
-	defer privateFile.Close()
-
-	// Construct a PEM block for the private key.
-	privateBlock := pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
-	}
-
-	// Write the private key to the private key file.
-	if err := pem.Encode(privateFile, &privateBlock); err != nil {
-		return fmt.Errorf("encoding to private file: %w", err)
-	}
+// printCommands shows the set of commands the tool supports.
+func printCommands() {
+	fmt.Println("COMMANDS")
+	fmt.Println("  migrate [up]                                   create the schema in the database")
+	fmt.Println("  migrate status                                 show applied and pending migrations")
+	fmt.Println("  migrate dry-run                                print the SQL of pending migrations")
+	fmt.Println("  migrate down <version> [dry-run]               roll the schema back to a version")
+	fmt.Println("  seed [set] [users] [products] [sales]          add a seed set (test, dev, demo) to the database")
+	fmt.Println("  delete-all                                     remove all the data from the database")
+	fmt.Println("  env [name]                                     show or set the environment the database is flagged as")
+	fmt.Println("  error-codes                                    print the error codes returned by the API as markdown")
+	fmt.Println("  genkey                                         generate a new private key in the keys folder")
+	fmt.Println("  gentoken <user_id> [kid]                       generate a token for a user")
+	fmt.Println("  users create <name> <email> <password> [roles] add a user, roles are comma separated")
+	fmt.Println("  users list [page] [rows]                       list the users")
+	fmt.Println("  users set-roles <user_id> <roles>              replace the roles of a user")
+	fmt.Println("  keys list                                      list the key ids, * marks the active kid")
+}
 
-	// Marshal the public key from the private key to PKIX.
-	asn1Bytes, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
-	if err != nil {
-		return fmt.Errorf("marshaling public key: %w", err)
-	}
+// paging parses the optional page and rows arguments.
+func paging(page string, rows string) (int, int, error) {
+	pageNumber, rowsPerPage := 1, 50
 
-	// Create a file for the public key information in PEM form.
-	publicFile, err := os.Create("public.pem")
-	if err != nil {
-		return fmt.Errorf("creating public file: %w", err)
-	}
-	defer publicFile.Close()
-
-	// Construct a PEM block for the public key.
-	publicBlock := pem.Block{
-		Type:  "RSA PUBLIC KEY",
-		Bytes: asn1Bytes,
+	if page != "" {
+		n, err := strconv.Atoi(page)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid page format [%s]", page)
+		}
+		pageNumber = n
 	}
 
-	// Write the public key to the private key file.
-	if err := pem.Encode(publicFile, &publicBlock); err != nil {
-		return fmt.Errorf("encoding to public file: %w", err)
+	if rows != "" {
+		n, err := strconv.Atoi(rows)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid rows format [%s]", rows)
+		}
+		rowsPerPage = n
 	}
 
-	fmt.Println("private and public key files generated")
-	return nil
+	return pageNumber, rowsPerPage, nil
 }
@@ -6,23 +6,94 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"sort"
 	"strings"
+	"time"
 )
 
-var service string
+var (
+	service string
+	level   string
+	traceID string
+	message string
+	since   string
+	until   string
+	format  string
+	color   bool
+)
 
 func init() {
 	flag.StringVar(&service, "service", "", "filter which service to see")
+	flag.StringVar(&level, "level", "", "filter out entries below this level (debug, info, warn, error)")
+	flag.StringVar(&traceID, "traceid", "", "filter which trace to see")
+	flag.StringVar(&message, "msg", "", "filter entries whose message contains this text")
+	flag.StringVar(&since, "since", "", "filter out entries before this RFC3339 time")
+	flag.StringVar(&until, "until", "", "filter out entries after this RFC3339 time")
+	flag.StringVar(&format, "format", "text", "output format: text, logfmt, json or trace")
+	flag.BoolVar(&color, "color", false, "color the output by level")
+}
+
+// emptyTraceID is used for entries that don't carry a trace id.
+const emptyTraceID = "00000000-0000-0000-0000-000000000000"
+
+// knownKeys are the keys printed up front in a fixed order. Every other key
+// is printed after them in sorted order.
+var knownKeys = []string{"service", "ts", "level", "traceid", "caller", "msg"}
+
+// levels orders the zap levels so entries can be filtered by a minimum level.
+var levels = map[string]int{
+	"debug":  0,
+	"info":   1,
+	"warn":   2,
+	"error":  3,
+	"dpanic": 4,
+	"panic":  5,
+	"fatal":  6,
+}
+
+// ANSI color codes used per level.
+var colors = map[string]string{
+	"debug":  "\033[90m",
+	"info":   "\033[36m",
+	"warn":   "\033[33m",
+	"error":  "\033[31m",
+	"dpanic": "\033[35m",
+	"panic":  "\033[35m",
+	"fatal":  "\033[35m",
 }
 
+const colorReset = "\033[0m"
+
 func main() {
 	flag.Parse()
-	var b strings.Builder
+
+	f, err := newFilter()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	var p printer
+	switch format {
+	case "text":
+		p = newLinePrinter(os.Stdout, formatText)
+	case "logfmt":
+		p = newLinePrinter(os.Stdout, formatLogfmt)
+	case "json":
+		p = newLinePrinter(os.Stdout, formatJSON)
+	case "trace":
+		p = newTracePrinter(os.Stdout)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", format)
+		os.Exit(1)
+	}
 
 	// Scan standard input for log data per line.
 	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
 	for scanner.Scan() {
 		s := scanner.Text()
 
@@ -30,54 +101,312 @@ func main() {
 		m := make(map[string]interface{})
 		err := json.Unmarshal([]byte(s), &m)
 		if err != nil {
-			if service == "" {
-				fmt.Println(s)
+			if f.empty() {
+				p.raw(s)
 			}
 			continue
 		}
 
-		// If a service filter was provided, check.
-		if service != "" && m["service"] != service {
+		// I like always having a traceid present in the logs.
+		if _, ok := m["traceid"]; !ok {
+			m["traceid"] = emptyTraceID
+		}
+
+		if !f.match(m) {
 			continue
 		}
 
-		// I like always having a traceid present in the logs.
-		traceID := "00000000-0000-0000-0000-000000000000"
-		if v, ok := m["traceid"]; ok {
-			traceID = fmt.Sprintf("%v", v)
+		p.entry(m)
+	}
+	p.flush()
+
+	if err := scanner.Err(); err != nil {
+		log.Println(err)
+	}
+}
+
+// =============================================================================
+
+// filter holds the parsed filter flags.
+type filter struct {
+	level int
+	since time.Time
+	until time.Time
+}
+
+// newFilter validates and parses the filter flags.
+func newFilter() (filter, error) {
+	var f filter
+
+	if level != "" {
+		lvl, ok := levels[strings.ToLower(level)]
+		if !ok {
+			return filter{}, fmt.Errorf("unknown level %q", level)
 		}
+		f.level = lvl
+	}
 
-		// Build out the know portions of the log in the order
-		// I want them in.
-		b.Reset()
-		b.WriteString(fmt.Sprintf("%s: %s: %s: %s: %s: %s: ",
-			m["service"],
-			m["ts"],
-			m["level"],
-			traceID,
-			m["caller"],
-			m["msg"],
-		))
-
-		// Add the rest of the keys ignoring the ones we already
-		// added for the log.
-		for k, v := range m {
-			switch k {
-			case "service", "ts", "level", "traceid", "caller", "msg":
-				continue
-			}
+	if since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return filter{}, fmt.Errorf("parsing since: %w", err)
+		}
+		f.since = t
+	}
 
-			// It's nice to see the key[value] in this format
-			// especially since map ordering is random.
-			b.WriteString(fmt.Sprintf("%s[%v]: ", k, v))
+	if until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return filter{}, fmt.Errorf("parsing until: %w", err)
 		}
+		f.until = t
+	}
+
+	return f, nil
+}
+
+// empty reports if no filter flags were provided.
+func (f filter) empty() bool {
+	return service == "" && level == "" && traceID == "" && message == "" && since == "" && until == ""
+}
 
-		// Write the new log format, removing the last :
-		out := b.String()
-		fmt.Println(out[:len(out)-2])
+// match reports if the entry passes all the provided filters.
+func (f filter) match(m map[string]interface{}) bool {
+	if service != "" && m["service"] != service {
+		return false
 	}
 
-	if err := scanner.Err(); err != nil {
-		log.Println(err)
+	if traceID != "" && fmt.Sprintf("%v", m["traceid"]) != traceID {
+		return false
+	}
+
+	if message != "" && !strings.Contains(fmt.Sprintf("%v", m["msg"]), message) {
+		return false
+	}
+
+	if level != "" {
+		lvl, ok := levels[fmt.Sprintf("%v", m["level"])]
+		if ok && lvl < f.level {
+			return false
+		}
+	}
+
+	if !f.since.IsZero() || !f.until.IsZero() {
+		ts, err := parseTime(fmt.Sprintf("%v", m["ts"]))
+		if err != nil {
+			return false
+		}
+		if !f.since.IsZero() && ts.Before(f.since) {
+			return false
+		}
+		if !f.until.IsZero() && ts.After(f.until) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseTime parses the timestamp written by the zap ISO8601 encoder.
+func parseTime(ts string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02T15:04:05.000Z0700", ts)
+	if err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339Nano, ts)
+}
+
+// =============================================================================
+
+// printer writes the entries that passed the filters.
+type printer interface {
+	raw(s string)
+	entry(m map[string]interface{})
+	flush()
+}
+
+// formatFunc converts an entry into its output form.
+type formatFunc func(m map[string]interface{}) string
+
+// linePrinter writes each entry as soon as it is read.
+type linePrinter struct {
+	w      io.Writer
+	format formatFunc
+}
+
+func newLinePrinter(w io.Writer, format formatFunc) *linePrinter {
+	return &linePrinter{w: w, format: format}
+}
+
+func (p *linePrinter) raw(s string) {
+	fmt.Fprintln(p.w, s)
+}
+
+func (p *linePrinter) entry(m map[string]interface{}) {
+	fmt.Fprintln(p.w, colorize(m, p.format(m)))
+}
+
+func (p *linePrinter) flush() {}
+
+// tracePrinter groups the entries of a request together. Entries are held
+// until the request completes and are then written out as one block.
+type tracePrinter struct {
+	w      io.Writer
+	order  []string
+	traces map[string][]map[string]interface{}
+}
+
+func newTracePrinter(w io.Writer) *tracePrinter {
+	return &tracePrinter{
+		w:      w,
+		traces: make(map[string][]map[string]interface{}),
+	}
+}
+
+func (p *tracePrinter) raw(s string) {
+	fmt.Fprintln(p.w, s)
+}
+
+func (p *tracePrinter) entry(m map[string]interface{}) {
+	id := fmt.Sprintf("%v", m["traceid"])
+
+	// Entries outside of a request have nothing to be grouped with.
+	if id == emptyTraceID {
+		fmt.Fprintln(p.w, colorize(m, formatText(m)))
+		return
+	}
+
+	if _, exists := p.traces[id]; !exists {
+		p.order = append(p.order, id)
+	}
+	p.traces[id] = append(p.traces[id], m)
+
+	if m["msg"] == "request completed" {
+		p.write(id)
+	}
+}
+
+func (p *tracePrinter) flush() {
+	for len(p.order) > 0 {
+		p.write(p.order[0])
+	}
+}
+
+// write outputs the block of entries for the trace and forgets about it.
+func (p *tracePrinter) write(id string) {
+	entries := p.traces[id]
+	delete(p.traces, id)
+	for i, v := range p.order {
+		if v == id {
+			p.order = append(p.order[:i], p.order[i+1:]...)
+			break
+		}
+	}
+
+	fmt.Fprintf(p.w, "==== trace %s (%d entries) ====\n", id, len(entries))
+	for _, m := range entries {
+		fmt.Fprintln(p.w, "    "+colorize(m, formatText(m)))
+	}
+}
+
+// =============================================================================
+
+// formatText builds out the know portions of the log in the order I want them
+// in followed by the rest of the keys in sorted order.
+func formatText(m map[string]interface{}) string {
+	var b strings.Builder
+
+	b.WriteString(fmt.Sprintf("%s: %s: %s: %s: %s: %s: ",
+		m["service"],
+		m["ts"],
+		m["level"],
+		m["traceid"],
+		m["caller"],
+		m["msg"],
+	))
+
+	// It's nice to see the key[value] in this format.
+	for _, k := range extraKeys(m) {
+		b.WriteString(fmt.Sprintf("%s[%v]: ", k, m[k]))
+	}
+
+	// Remove the last :
+	out := b.String()
+	return out[:len(out)-2]
+}
+
+// formatLogfmt writes the entry as key=value pairs.
+func formatLogfmt(m map[string]interface{}) string {
+	var pairs []string
+	for _, k := range knownKeys {
+		if v, ok := m[k]; ok {
+			pairs = append(pairs, k+"="+logfmtValue(v))
+		}
+	}
+	for _, k := range extraKeys(m) {
+		pairs = append(pairs, k+"="+logfmtValue(m[k]))
+	}
+
+	return strings.Join(pairs, " ")
+}
+
+// formatJSON writes the entry as indented JSON.
+func formatJSON(m map[string]interface{}) string {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+// extraKeys returns the keys of the entry that are not known keys in sorted
+// order so the output is stable.
+func extraKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		switch k {
+		case "service", "ts", "level", "traceid", "caller", "msg":
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// logfmtValue quotes the value when it contains characters that would break
+// the key=value layout.
+func logfmtValue(v interface{}) string {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err.Error()
+		}
+		s = string(data)
+	default:
+		s = fmt.Sprintf("%v", v)
+	}
+
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
+}
+
+// colorize wraps the output in the ANSI color for the entry's level.
+func colorize(m map[string]interface{}, out string) string {
+	if !color {
+		return out
+	}
+
+	c, ok := colors[fmt.Sprintf("%v", m["level"])]
+	if !ok {
+		return out
 	}
+	return c + out + colorReset
 }
@@ -11,6 +11,8 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/piyush-saurabh/go-service/business/data/store/user"
 	"github.com/piyush-saurabh/go-service/business/sys/auth"
+	"github.com/piyush-saurabh/go-service/foundation/web"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
@@ -21,7 +23,7 @@ type Core struct {
 }
 
 // NewCore constructs a core for user api access.
-func NewCore(log *zap.SugaredLogger, db *sqlx.DB) Core {
+func NewCore(log *zap.SugaredLogger, db sqlx.ExtContext) Core {
 	return Core{
 		log:  log,
 		user: user.NewStore(log, db),
@@ -31,11 +33,14 @@ func NewCore(log *zap.SugaredLogger, db *sqlx.DB) Core {
 // [PS] this is the wrapper around the data layer with some extra business logic
 // Create inserts a new user into the database.
 func (c Core) Create(ctx context.Context, nu user.NewUser, now time.Time) (user.User, error) {
+	ctx, span := web.AddSpan(ctx, "business.core.user.create")
+	defer span.End()
 
 	// PERFORM PRE BUSINESS OPERATIONS
 
 	usr, err := c.user.Create(ctx, nu, now)
 	if err != nil {
+		web.SpanError(span, err)
 		return user.User{}, fmt.Errorf("create: %w", err)
 	}
 
@@ -46,10 +51,13 @@ func (c Core) Create(ctx context.Context, nu user.NewUser, now time.Time) (user.
 
 // Update replaces a user document in the database.
 func (c Core) Update(ctx context.Context, claims auth.Claims, userID string, uu user.UpdateUser, now time.Time) error {
+	ctx, span := web.AddSpan(ctx, "business.core.user.update", attribute.String("user.id", userID))
+	defer span.End()
 
 	// PERFORM PRE BUSINESS OPERATIONS
 
 	if err := c.user.Update(ctx, claims, userID, uu, now); err != nil {
+		web.SpanError(span, err)
 		return fmt.Errorf("udpate: %w", err)
 	}
 
@@ -58,12 +66,32 @@ func (c Core) Update(ctx context.Context, claims auth.Claims, userID string, uu
 	return nil
 }
 
+// Patch applies a patch document to a user in the database.
+func (c Core) Patch(ctx context.Context, claims auth.Claims, userID string, p user.Patch, now time.Time) error {
+	ctx, span := web.AddSpan(ctx, "business.core.user.patch", attribute.String("user.id", userID))
+	defer span.End()
+
+	// PERFORM PRE BUSINESS OPERATIONS
+
+	if err := c.user.Patch(ctx, claims, userID, p, now); err != nil {
+		web.SpanError(span, err)
+		return fmt.Errorf("patch: %w", err)
+	}
+
+	// PERFORM POST BUSINESS OPERATIONS
+
+	return nil
+}
+
 // Delete removes a user from the database.
 func (c Core) Delete(ctx context.Context, claims auth.Claims, userID string) error {
+	ctx, span := web.AddSpan(ctx, "business.core.user.delete", attribute.String("user.id", userID))
+	defer span.End()
 
 	// PERFORM PRE BUSINESS OPERATIONS
 
 	if err := c.user.Delete(ctx, claims, userID); err != nil {
+		web.SpanError(span, err)
 		return fmt.Errorf("delete: %w", err)
 	}
 
@@ -74,11 +102,14 @@ func (c Core) Delete(ctx context.Context, claims auth.Claims, userID string) err
 
 // Query retrieves a list of existing users from the database.
 func (c Core) Query(ctx context.Context, pageNumber int, rowsPerPage int) ([]user.User, error) {
+	ctx, span := web.AddSpan(ctx, "business.core.user.query")
+	defer span.End()
 
 	// PERFORM PRE BUSINESS OPERATIONS
 
 	users, err := c.user.Query(ctx, pageNumber, rowsPerPage)
 	if err != nil {
+		web.SpanError(span, err)
 		return nil, fmt.Errorf("query: %w", err)
 	}
 
@@ -87,13 +118,29 @@ func (c Core) Query(ctx context.Context, pageNumber int, rowsPerPage int) ([]use
 	return users, nil
 }
 
+// QueryAll calls fn with every user in the system, one at a time.
+func (c Core) QueryAll(ctx context.Context, fn func(usr user.User) error) error {
+	ctx, span := web.AddSpan(ctx, "business.core.user.queryall")
+	defer span.End()
+
+	if err := c.user.QueryAll(ctx, fn); err != nil {
+		web.SpanError(span, err)
+		return fmt.Errorf("query: %w", err)
+	}
+
+	return nil
+}
+
 // QueryByID gets the specified user from the database.
 func (c Core) QueryByID(ctx context.Context, claims auth.Claims, userID string) (user.User, error) {
+	ctx, span := web.AddSpan(ctx, "business.core.user.querybyid", attribute.String("user.id", userID))
+	defer span.End()
 
 	// PERFORM PRE BUSINESS OPERATIONS
 
 	usr, err := c.user.QueryByID(ctx, claims, userID)
 	if err != nil {
+		web.SpanError(span, err)
 		return user.User{}, fmt.Errorf("query: %w", err)
 	}
 
@@ -104,11 +151,14 @@ func (c Core) QueryByID(ctx context.Context, claims auth.Claims, userID string)
 
 // QueryByEmail gets the specified user from the database by email.
 func (c Core) QueryByEmail(ctx context.Context, claims auth.Claims, email string) (user.User, error) {
+	ctx, span := web.AddSpan(ctx, "business.core.user.querybyemail")
+	defer span.End()
 
 	// PERFORM PRE BUSINESS OPERATIONS
 
 	usr, err := c.user.QueryByID(ctx, claims, email)
 	if err != nil {
+		web.SpanError(span, err)
 		return user.User{}, fmt.Errorf("query: %w", err)
 	}
 
@@ -121,11 +171,14 @@ func (c Core) QueryByEmail(ctx context.Context, claims auth.Claims, email string
 // success it returns a Claims User representing this user. The claims can be
 // used to generate a token for future authentication.
 func (c Core) Authenticate(ctx context.Context, now time.Time, email, password string) (auth.Claims, error) {
+	ctx, span := web.AddSpan(ctx, "business.core.user.authenticate")
+	defer span.End()
 
 	// PERFORM PRE BUSINESS OPERATIONS
 
 	claims, err := c.user.Authenticate(ctx, now, email, password)
 	if err != nil {
+		web.SpanError(span, err)
 		return auth.Claims{}, fmt.Errorf("query: %w", err)
 	}
 
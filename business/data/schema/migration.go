@@ -0,0 +1,274 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ardanlabs/darwin"
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrModified is returned when a migration that was already applied to the
+// database has been edited since.
+var ErrModified = errors.New("applied migration has been modified")
+
+// Migration represents a single versioned change to the schema along with
+// the script that undoes it.
+type Migration struct {
+	Version     float64
+	Description string
+	Up          string
+	Down        string
+	Checksum    string
+}
+
+// MigrationStatus describes the state of a migration in the database.
+type MigrationStatus struct {
+	Migration
+	Applied         bool
+	AppliedAt       time.Time
+	AppliedChecksum string
+	Modified        bool // applied, but the script has changed since
+	Removed         bool // applied, but no longer defined in this package
+}
+
+// Migrations returns the set of migrations defined in this package in
+// version order.
+func Migrations() ([]Migration, error) {
+	ups := darwin.ParseMigrations(schemaDoc)
+	downs := darwin.ParseMigrations(schemaDownDoc)
+
+	var migs []Migration
+	for _, up := range ups {
+		migs = append(migs, Migration{
+			Version:     up.Version,
+			Description: up.Description,
+			Up:          up.Script,
+			Checksum:    up.Checksum(),
+		})
+	}
+
+	for _, down := range downs {
+		i := find(migs, down.Version)
+		if i == -1 {
+			return nil, fmt.Errorf("down migration for unknown version %v", down.Version)
+		}
+		migs[i].Down = down.Script
+	}
+
+	sort.Slice(migs, func(i, j int) bool { return migs[i].Version < migs[j].Version })
+
+	return migs, nil
+}
+
+// Status reports every migration known to this package or the database with
+// whether it has been applied and if its checksum still matches.
+func Status(ctx context.Context, db *sqlx.DB) ([]MigrationStatus, error) {
+	migs, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := applied(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migs))
+	for i, mig := range migs {
+		statuses[i].Migration = mig
+	}
+
+	for _, rec := range records {
+		i := find(migs, rec.Version)
+		if i == -1 {
+			statuses = append(statuses, MigrationStatus{
+				Migration: Migration{
+					Version:     rec.Version,
+					Description: rec.Description,
+				},
+				Applied:         true,
+				AppliedAt:       rec.AppliedAt,
+				AppliedChecksum: rec.Checksum,
+				Removed:         true,
+			})
+			continue
+		}
+
+		statuses[i].Applied = true
+		statuses[i].AppliedAt = rec.AppliedAt
+		statuses[i].AppliedChecksum = rec.Checksum
+		statuses[i].Modified = rec.Checksum != statuses[i].Checksum
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+
+	return statuses, nil
+}
+
+// Pending returns the migrations Migrate would apply, in the order they
+// would be applied. It is used to preview a migration without running it.
+func Pending(ctx context.Context, db *sqlx.DB) ([]Migration, error) {
+	statuses, err := Status(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkModified(statuses); err != nil {
+		return nil, err
+	}
+
+	var last float64
+	for _, s := range statuses {
+		if s.Applied && s.Version > last {
+			last = s.Version
+		}
+	}
+
+	var pending []Migration
+	for _, s := range statuses {
+		if !s.Applied && s.Version > last {
+			pending = append(pending, s.Migration)
+		}
+	}
+
+	return pending, nil
+}
+
+// RollbackPlan returns the migrations Rollback would undo to bring the
+// database back to the target version, in the order they would be undone.
+func RollbackPlan(ctx context.Context, db *sqlx.DB, target float64) ([]Migration, error) {
+	statuses, err := Status(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var plan []Migration
+	for i := len(statuses) - 1; i >= 0; i-- {
+		s := statuses[i]
+		if !s.Applied || s.Version <= target || sameVersion(s.Version, target) {
+			continue
+		}
+		if s.Down == "" {
+			return nil, fmt.Errorf("no down migration for version %v", s.Version)
+		}
+		plan = append(plan, s.Migration)
+	}
+
+	return plan, nil
+}
+
+// Rollback undoes every applied migration above the target version starting
+// with the most recent. Each migration is undone in its own transaction along
+// with the removal of its record, so a failure leaves the database at the last
+// successfully rolled back version.
+func Rollback(ctx context.Context, db *sqlx.DB, target float64) error {
+	plan, err := RollbackPlan(ctx, db, target)
+	if err != nil {
+		return err
+	}
+
+	for _, mig := range plan {
+		if err := rollback(ctx, db, mig); err != nil {
+			return fmt.Errorf("rollback version %v: %w", mig.Version, err)
+		}
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// record represents a row in the darwin migrations table.
+type record struct {
+	Version     float64
+	Description string
+	Checksum    string
+	AppliedAt   time.Time
+}
+
+// applied returns the migrations recorded in the database.
+func applied(ctx context.Context, db *sqlx.DB) ([]record, error) {
+	if _, err := db.ExecContext(ctx, darwin.PostgresDialect{}.CreateTableSQL()); err != nil {
+		return nil, fmt.Errorf("creating migrations table: %w", err)
+	}
+
+	const q = `
+	SELECT
+		version, description, checksum, applied_at
+	FROM
+		darwin_migrations
+	ORDER BY
+		version`
+
+	rows, err := db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("selecting migrations: %w", err)
+	}
+	defer rows.Close()
+
+	var records []record
+	for rows.Next() {
+		var rec record
+		var appliedAt int64
+		if err := rows.Scan(&rec.Version, &rec.Description, &rec.Checksum, &appliedAt); err != nil {
+			return nil, fmt.Errorf("scanning migration: %w", err)
+		}
+		rec.AppliedAt = time.Unix(appliedAt, 0)
+		records = append(records, rec)
+	}
+
+	return records, rows.Err()
+}
+
+// rollback runs the down script of the migration and removes its record.
+func rollback(ctx context.Context, db *sqlx.DB, mig Migration) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, mig.Down); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// The version column is a REAL so the parameter has to be compared at
+	// the same precision.
+	const q = `DELETE FROM darwin_migrations WHERE version = $1::real`
+	if _, err := tx.ExecContext(ctx, q, mig.Version); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// checkModified returns ErrModified if any applied migration was edited.
+func checkModified(statuses []MigrationStatus) error {
+	for _, s := range statuses {
+		if s.Modified {
+			return fmt.Errorf("%w: version %v", ErrModified, s.Version)
+		}
+	}
+	return nil
+}
+
+// find returns the index of the migration with the version or -1.
+func find(migs []Migration, version float64) int {
+	for i, mig := range migs {
+		if sameVersion(mig.Version, version) {
+			return i
+		}
+	}
+	return -1
+}
+
+// sameVersion compares versions at the precision they are stored in the
+// database, since the darwin migrations table keeps them as a REAL.
+func sameVersion(a, b float64) bool {
+	return float32(a) == float32(b)
+}
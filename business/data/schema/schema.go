@@ -9,6 +9,7 @@ import (
 	"github.com/ardanlabs/darwin"
 	"github.com/jmoiron/sqlx"
 	"github.com/piyush-saurabh/go-service/business/sys/database"
+	"go.uber.org/zap"
 )
 
 // [PS] new go feature in 1.17
@@ -17,6 +18,9 @@ var (
 	//go:embed sql/schema.sql
 	schemaDoc string
 
+	//go:embed sql/schema_down.sql
+	schemaDownDoc string
+
 	//go:embed sql/seed.sql
 	seedDoc string
 
@@ -25,12 +29,21 @@ var (
 )
 
 // Migrate attempts to bring the schema for db up to date with the migrations
-// defined in this package.
+// defined in this package. It refuses to run if a migration that was already
+// applied has been modified since.
 func Migrate(ctx context.Context, db *sqlx.DB) error {
 	if err := database.StatusCheck(ctx, db); err != nil {
 		return fmt.Errorf("status check database: %w", err)
 	}
 
+	statuses, err := Status(ctx, db)
+	if err != nil {
+		return fmt.Errorf("migration status: %w", err)
+	}
+	if err := checkModified(statuses); err != nil {
+		return err
+	}
+
 	driver, err := darwin.NewGenericDriver(db.DB, darwin.PostgresDialect{})
 	if err != nil {
 		return fmt.Errorf("construct darwin driver: %w", err)
@@ -40,42 +53,64 @@ func Migrate(ctx context.Context, db *sqlx.DB) error {
 	return d.Migrate()
 }
 
-// Seed runs the set of seed-data queries against db. The queries are ran in a
-// transaction and rolled back if any fail.
-func Seed(ctx context.Context, db *sqlx.DB) error {
+// migrationLockKey is the advisory lock key used to make sure only one
+// instance of the service runs migrations at a time.
+const migrationLockKey = 4337001
+
+// MigrateLocked runs Migrate while holding an advisory lock, so when several
+// instances start at the same time only one of them applies the migrations.
+// The others wait for the lock and then find nothing left to do. The lock
+// holds a connection while the migrations run on another, so the pool for db
+// must allow at least two open connections.
+func MigrateLocked(ctx context.Context, db *sqlx.DB) error {
 	if err := database.StatusCheck(ctx, db); err != nil {
 		return fmt.Errorf("status check database: %w", err)
 	}
 
-	tx, err := db.Begin()
-	if err != nil {
+	f := func() error {
+		return Migrate(ctx, db)
+	}
+
+	return database.WithAdvisoryLock(ctx, db, migrationLockKey, f)
+}
+
+// Seed loads the seed set into db. The fixed rows in seed.sql are loaded
+// first followed by the generated rows of the set. Every row has a stable id
+// and conflicting rows are skipped, so seeding the same set again only adds
+// what is missing. The queries are ran in a transaction and rolled back if
+// any fail, a transaction that conflicts with the running service is ran
+// again. Seeding a database flagged as production returns ErrProduction.
+func Seed(ctx context.Context, log *zap.SugaredLogger, db *sqlx.DB, set SeedSet) error {
+	if err := database.StatusCheck(ctx, db); err != nil {
+		return fmt.Errorf("status check database: %w", err)
+	}
+
+	if err := checkNotProduction(ctx, db); err != nil {
 		return err
 	}
 
-	if _, err := tx.Exec(seedDoc); err != nil {
-		if err := tx.Rollback(); err != nil {
+	f := func(tx sqlx.ExtContext) error {
+		if _, err := tx.ExecContext(ctx, seedDoc); err != nil {
 			return err
 		}
-		return err
+		return generate(ctx, tx, set)
 	}
 
-	return tx.Commit()
+	return database.WithinTran(ctx, log, db, f)
 }
 
 // DeleteAll runs the set of Drop-table queries against db. The queries are ran in a
-// transaction and rolled back if any fail.
-func DeleteAll(db *sqlx.DB) error {
-	tx, err := db.Begin()
-	if err != nil {
+// transaction and rolled back if any fail. Deleting from a database flagged as
+// production returns ErrProduction.
+func DeleteAll(ctx context.Context, log *zap.SugaredLogger, db *sqlx.DB) error {
+	if err := checkNotProduction(ctx, db); err != nil {
 		return err
 	}
 
-	if _, err := tx.Exec(deleteDoc); err != nil {
-		if err := tx.Rollback(); err != nil {
-			return err
-		}
+	f := func(tx sqlx.ExtContext) error {
+		_, err := tx.ExecContext(ctx, deleteDoc)
 		return err
 	}
 
-	return tx.Commit()
+	return database.WithinTran(ctx, log, db, f)
 }
@@ -0,0 +1,283 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrProduction is returned when seeding or deleting data is attempted against
+// a database flagged as production.
+var ErrProduction = errors.New("refusing to modify a production database")
+
+// EnvProduction is the environment name that flags a production database.
+const EnvProduction = "production"
+
+// SeedSet describes a named set of seed data. Every set loads the fixed users,
+// products and sales from seed.sql and then generates the configured number
+// of fake rows on top of them.
+type SeedSet struct {
+	Name     string
+	Users    int
+	Products int
+	Sales    int
+}
+
+// Set of known seed sets. The volumes can be adjusted by the caller.
+var (
+	SeedTest = SeedSet{Name: "test"}
+	SeedDev  = SeedSet{Name: "dev", Users: 10, Products: 25, Sales: 100}
+	SeedDemo = SeedSet{Name: "demo", Users: 100, Products: 500, Sales: 5000}
+)
+
+// LookupSeedSet returns the seed set with the specified name.
+func LookupSeedSet(name string) (SeedSet, error) {
+	for _, set := range []SeedSet{SeedTest, SeedDev, SeedDemo} {
+		if set.Name == name {
+			return set, nil
+		}
+	}
+	return SeedSet{}, fmt.Errorf("unknown seed set %q", name)
+}
+
+// Environment returns the environment the database is flagged as. An empty
+// string is returned when no flag has been set.
+func Environment(ctx context.Context, db sqlx.QueryerContext) (string, error) {
+	const q = `SELECT value FROM settings WHERE key = 'environment'`
+
+	var env string
+	if err := sqlx.GetContext(ctx, db, &env, q); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", fmt.Errorf("selecting environment: %w", err)
+	}
+
+	return env, nil
+}
+
+// SetEnvironment flags the database as belonging to the named environment.
+func SetEnvironment(ctx context.Context, db *sqlx.DB, env string) error {
+	const q = `
+	INSERT INTO settings
+		(key, value)
+	VALUES
+		('environment', $1)
+	ON CONFLICT (key) DO UPDATE SET
+		value = EXCLUDED.value`
+
+	if _, err := db.ExecContext(ctx, q, env); err != nil {
+		return fmt.Errorf("setting environment: %w", err)
+	}
+
+	return nil
+}
+
+// checkNotProduction returns ErrProduction if the database is flagged as
+// production.
+func checkNotProduction(ctx context.Context, db sqlx.QueryerContext) error {
+	env, err := Environment(ctx, db)
+	if err != nil {
+		return err
+	}
+	if env == EnvProduction {
+		return ErrProduction
+	}
+	return nil
+}
+
+// =============================================================================
+
+// seedNamespace is used to derive the ids of the generated rows. Deriving the
+// ids from the set name and row number makes seeding the same set again a
+// no-op for the rows that already exist.
+var seedNamespace = uuid.MustParse("8e3f0c4a-5b1d-4f5e-9a52-6c1b8f3d2e71")
+
+// seedPasswordHash is the hash of "gophers" used for every generated user.
+const seedPasswordHash = "$2a$10$1ggfMVZV6Js0ybvJufLRUOWHS5f6KneuP0XwwHpJ8L8ipdry9f2/a"
+
+// seedBatch is the number of rows inserted per statement.
+const seedBatch = 500
+
+// Fixed rows from seed.sql that generated rows fall back to when the set
+// doesn't generate their parents.
+const (
+	seedUserID    = "45b5fbd3-755f-4379-8f07-a58d4a30fa2f"
+	seedProductID = "a2b0639f-2cc6-44b8-b97b-15d69dbb511e"
+)
+
+var (
+	firstNames   = []string{"Ada", "Bill", "Carmen", "Dmitri", "Erin", "Farah", "Gus", "Hana", "Ivan", "Jill", "Kofi", "Lena"}
+	lastNames    = []string{"Gopher", "Pike", "Thompson", "Griesemer", "Cox", "Kennedy", "Hudson", "Taylor", "Lopez", "Nguyen"}
+	productNames = []string{"Comic Books", "McDonalds Toys", "Trading Cards", "Board Game", "Puzzle", "Action Figure", "Vinyl Record", "Poster", "Model Kit", "Plush Toy"}
+)
+
+type seedUser struct {
+	ID           string    `db:"user_id"`
+	Name         string    `db:"name"`
+	Email        string    `db:"email"`
+	Roles        string    `db:"roles"`
+	PasswordHash string    `db:"password_hash"`
+	DateCreated  time.Time `db:"date_created"`
+}
+
+type seedProduct struct {
+	ID          string    `db:"product_id"`
+	UserID      string    `db:"user_id"`
+	Name        string    `db:"name"`
+	Cost        int       `db:"cost"`
+	Quantity    int       `db:"quantity"`
+	DateCreated time.Time `db:"date_created"`
+}
+
+type seedSale struct {
+	ID          string    `db:"sale_id"`
+	UserID      string    `db:"user_id"`
+	ProductID   string    `db:"product_id"`
+	Quantity    int       `db:"quantity"`
+	Paid        int       `db:"paid"`
+	DateCreated time.Time `db:"date_created"`
+}
+
+// generate inserts the fake data for the seed set. Every row is generated from
+// its own random source, seeded by the set name, table and row number, so the
+// same set always produces the same rows and raising a volume only adds rows
+// to that table. Products and sales pick their user and product among the
+// generated ones though, so changing the number of users or products changes
+// which ones they refer to.
+func generate(ctx context.Context, tx sqlx.ExtContext, set SeedSet) error {
+	base := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	userIDs := []string{seedUserID}
+	if set.Users > 0 {
+		users := make([]seedUser, set.Users)
+		userIDs = make([]string, set.Users)
+		for i := range users {
+			rnd := seedRand(set, "user", i)
+			first := firstNames[rnd.Intn(len(firstNames))]
+			last := lastNames[rnd.Intn(len(lastNames))]
+			users[i] = seedUser{
+				ID:           seedID(set, "user", i),
+				Name:         first + " " + last,
+				Email:        fmt.Sprintf("%s-user-%d@example.com", set.Name, i+1),
+				Roles:        "{USER}",
+				PasswordHash: seedPasswordHash,
+				DateCreated:  base.Add(time.Duration(i) * time.Minute),
+			}
+			userIDs[i] = users[i].ID
+		}
+
+		const q = `
+		INSERT INTO users
+			(user_id, name, email, roles, password_hash, date_created, date_updated)
+		VALUES
+			(:user_id, :name, :email, :roles, :password_hash, :date_created, :date_created)
+		ON CONFLICT DO NOTHING`
+
+		if err := insertBatches(ctx, tx, q, len(users), func(i, j int) interface{} { return users[i:j] }); err != nil {
+			return fmt.Errorf("inserting users: %w", err)
+		}
+	}
+
+	type product struct {
+		id   string
+		cost int
+	}
+	products := []product{{id: seedProductID, cost: 50}}
+	if set.Products > 0 {
+		prds := make([]seedProduct, set.Products)
+		products = make([]product, set.Products)
+		for i := range prds {
+			rnd := seedRand(set, "product", i)
+			prds[i] = seedProduct{
+				ID:          seedID(set, "product", i),
+				UserID:      userIDs[rnd.Intn(len(userIDs))],
+				Name:        productNames[rnd.Intn(len(productNames))],
+				Cost:        5 + rnd.Intn(200),
+				Quantity:    1 + rnd.Intn(500),
+				DateCreated: base.Add(time.Duration(i) * time.Hour),
+			}
+			products[i] = product{id: prds[i].ID, cost: prds[i].Cost}
+		}
+
+		const q = `
+		INSERT INTO products
+			(product_id, user_id, name, cost, quantity, date_created, date_updated)
+		VALUES
+			(:product_id, :user_id, :name, :cost, :quantity, :date_created, :date_created)
+		ON CONFLICT DO NOTHING`
+
+		if err := insertBatches(ctx, tx, q, len(prds), func(i, j int) interface{} { return prds[i:j] }); err != nil {
+			return fmt.Errorf("inserting products: %w", err)
+		}
+	}
+
+	if set.Sales > 0 {
+		sales := make([]seedSale, set.Sales)
+		for i := range sales {
+			rnd := seedRand(set, "sale", i)
+			prd := products[rnd.Intn(len(products))]
+			quantity := 1 + rnd.Intn(10)
+			sales[i] = seedSale{
+				ID:          seedID(set, "sale", i),
+				UserID:      userIDs[rnd.Intn(len(userIDs))],
+				ProductID:   prd.id,
+				Quantity:    quantity,
+				Paid:        quantity * prd.cost,
+				DateCreated: base.Add(time.Duration(i) * 10 * time.Minute),
+			}
+		}
+
+		const q = `
+		INSERT INTO sales
+			(sale_id, user_id, product_id, quantity, paid, date_created)
+		VALUES
+			(:sale_id, :user_id, :product_id, :quantity, :paid, :date_created)
+		ON CONFLICT DO NOTHING`
+
+		if err := insertBatches(ctx, tx, q, len(sales), func(i, j int) interface{} { return sales[i:j] }); err != nil {
+			return fmt.Errorf("inserting sales: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// insertBatches runs the named insert for rows [0, n) in batches so a single
+// statement stays below the postgres parameter limit.
+func insertBatches(ctx context.Context, tx sqlx.ExtContext, query string, n int, rows func(i, j int) interface{}) error {
+	for i := 0; i < n; i += seedBatch {
+		j := i + seedBatch
+		if j > n {
+			j = n
+		}
+		if _, err := sqlx.NamedExecContext(ctx, tx, query, rows(i, j)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seedID returns the stable id of the nth generated row of a kind.
+func seedID(set SeedSet, kind string, n int) string {
+	return uuid.NewSHA1(seedNamespace, []byte(seedKey(set, kind, n))).String()
+}
+
+// seedRand returns the random source for the nth generated row of a kind.
+func seedRand(set SeedSet, kind string, n int) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(seedKey(set, kind, n)))
+	return rand.New(rand.NewSource(int64(h.Sum64())))
+}
+
+// seedKey identifies the nth generated row of a kind within the set.
+func seedKey(set SeedSet, kind string, n int) string {
+	return fmt.Sprintf("%s/%s/%d", set.Name, kind, n)
+}
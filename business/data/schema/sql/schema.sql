@@ -40,4 +40,15 @@ CREATE TABLE sales (
 	PRIMARY KEY (sale_id),
 	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
 	FOREIGN KEY (product_id) REFERENCES products(product_id) ON DELETE CASCADE
-);
\ No newline at end of file
+);
+-- Version: 1.4
+-- Description: Create table settings
+CREATE TABLE settings (
+	key   TEXT,
+	value TEXT,
+
+	PRIMARY KEY (key)
+);
+-- Version: 1.5
+-- Description: Add version to users for optimistic locking
+ALTER TABLE users ADD COLUMN version INT NOT NULL DEFAULT 1;
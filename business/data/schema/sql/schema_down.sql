@@ -0,0 +1,19 @@
+-- Version: 1.1
+-- Description: Drop table users
+DROP TABLE IF EXISTS users;
+
+-- Version: 1.2
+-- Description: Drop table products
+DROP TABLE IF EXISTS products;
+
+-- Version: 1.3
+-- Description: Drop table sales
+DROP TABLE IF EXISTS sales;
+
+-- Version: 1.4
+-- Description: Drop table settings
+DROP TABLE IF EXISTS settings;
+
+-- Version: 1.5
+-- Description: Drop version from users
+ALTER TABLE users DROP COLUMN IF EXISTS version;
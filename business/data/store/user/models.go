@@ -1,9 +1,12 @@
 package user
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/lib/pq"
+	"github.com/piyush-saurabh/go-service/business/sys/auth"
+	"github.com/piyush-saurabh/go-service/business/sys/validate"
 )
 
 // [PS] core data type for mapping it with database
@@ -16,6 +19,7 @@ type User struct {
 	PasswordHash []byte         `db:"password_hash" json:"-"`
 	DateCreated  time.Time      `db:"date_created" json:"date_created"`
 	DateUpdated  time.Time      `db:"date_updated" json:"date_updated"`
+	Version      int            `db:"version" json:"version"`
 }
 
 // [PS] for CRUD operations
@@ -29,6 +33,11 @@ type NewUser struct {
 	PasswordConfirm string   `json:"password_confirm" validate:"eqfield=Password"`
 }
 
+// Validate checks the business rules the validation tags can't express.
+func (nu NewUser) Validate() error {
+	return checkRoles(nu.Roles)
+}
+
 // UpdateUser defines what information may be provided to modify an existing
 // User. All fields are optional so clients can send just the fields they want
 // changed. It uses pointer fields so we can differentiate between a field that
@@ -42,4 +51,55 @@ type UpdateUser struct {
 	Roles           []string `json:"roles"`
 	Password        *string  `json:"password"`
 	PasswordConfirm *string  `json:"password_confirm" validate:"omitempty,eqfield=Password"`
+
+	// Version is the version of the user the changes were made against. It
+	// is set from the If-Match header rather than the document, and when it
+	// doesn't match the stored version the update fails with ErrConflict.
+	Version *int `json:"-"`
+}
+
+// Validate checks the business rules the validation tags can't express.
+func (uu UpdateUser) Validate() error {
+	return checkRoles(uu.Roles)
+}
+
+// PatchUser is the document patches are applied to. It holds the fields of a
+// User that can be changed, so a patch can only touch those fields and the
+// result is validated like a new user.
+type PatchUser struct {
+	Name            string   `json:"name" validate:"required"`
+	Email           string   `json:"email" validate:"required,email"`
+	Roles           []string `json:"roles" validate:"required"`
+	Password        *string  `json:"password,omitempty"`
+	PasswordConfirm *string  `json:"password_confirm,omitempty" validate:"omitempty,eqfield=Password"`
+}
+
+// Validate checks the business rules the validation tags can't express.
+func (pu PatchUser) Validate() error {
+	return checkRoles(pu.Roles)
+}
+
+// Patch describes a change to a user as a patch document.
+type Patch struct {
+	ContentType string // web.ContentTypeMergePatch or web.ContentTypeJSONPatch
+	Document    []byte
+
+	// Version is the version of the user the patch was made against, see
+	// UpdateUser.
+	Version *int
+}
+
+// checkRoles validates every role is one the system knows about.
+func checkRoles(roles []string) error {
+	for _, role := range roles {
+		switch role {
+		case auth.RoleAdmin, auth.RoleUser:
+		default:
+			return validate.FieldErrors{{
+				Field: "roles",
+				Error: fmt.Sprintf("roles contains an unknown role [%s]", role),
+			}}
+		}
+	}
+	return nil
 }
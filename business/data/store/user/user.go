@@ -2,7 +2,10 @@
 package user
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -11,6 +14,9 @@ import (
 	"github.com/piyush-saurabh/go-service/business/sys/auth"
 	"github.com/piyush-saurabh/go-service/business/sys/database"
 	"github.com/piyush-saurabh/go-service/business/sys/validate"
+	"github.com/piyush-saurabh/go-service/foundation/web"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -19,11 +25,12 @@ import (
 // [PS] store is created because all CRUD operation requires same logging and db details and these should not be hidden in contexts
 type Store struct {
 	log *zap.SugaredLogger
-	db  *sqlx.DB
+	db  sqlx.ExtContext
 }
 
-// NewStore constructs a user store for api access.
-func NewStore(log *zap.SugaredLogger, db *sqlx.DB) Store {
+// NewStore constructs a user store for api access. When db is a *database.DB
+// the reads are routed to its replicas.
+func NewStore(log *zap.SugaredLogger, db sqlx.ExtContext) Store {
 	return Store{
 		log: log,
 		db:  db,
@@ -32,12 +39,21 @@ func NewStore(log *zap.SugaredLogger, db *sqlx.DB) Store {
 
 // Create inserts a new user into the database.
 // [PS] context is required for timeouts on db operations
-func (s Store) Create(ctx context.Context, nu NewUser, now time.Time) (User, error) {
+func (s Store) Create(ctx context.Context, nu NewUser, now time.Time) (_ User, err error) {
+	ctx, span := web.AddSpan(ctx, "business.data.store.user.create")
+	defer span.End()
+	defer func() { spanError(span, err) }()
 
 	// [PS] Perform the validation
+	// Requests to the API were validated by web.Decode already. The store
+	// checks again since it's the last stop before the database and is also
+	// called outside of the API, like from tests and tooling.
 	if err := validate.Check(nu); err != nil {
 		return User{}, fmt.Errorf("validating data: %w", err)
 	}
+	if err := nu.Validate(); err != nil {
+		return User{}, fmt.Errorf("validating data: %w", err)
+	}
 
 	// [PS] generate the password hash for storing in database
 	hash, err := bcrypt.GenerateFromPassword([]byte(nu.Password), bcrypt.DefaultCost)
@@ -54,15 +70,17 @@ func (s Store) Create(ctx context.Context, nu NewUser, now time.Time) (User, err
 		Roles:        nu.Roles,
 		DateCreated:  now,
 		DateUpdated:  now,
+		Version:      1,
 	}
+	span.SetAttributes(attribute.String("user.id", usr.ID))
 
 	// [PS] Query
 	// [PS] substitution is handled by sqlx. The field name is specified in models.go
 	const q = `
 	INSERT INTO users
-		(user_id, name, email, password_hash, roles, date_created, date_updated)
+		(user_id, name, email, password_hash, roles, date_created, date_updated, version)
 	VALUES
-		(:user_id, :name, :email, :password_hash, :roles, :date_created, :date_updated)`
+		(:user_id, :name, :email, :password_hash, :roles, :date_created, :date_updated, :version)`
 
 	if err := database.NamedExecContext(ctx, s.log, s.db, q, usr); err != nil {
 		return User{}, fmt.Errorf("inserting user: %w", err)
@@ -71,20 +89,37 @@ func (s Store) Create(ctx context.Context, nu NewUser, now time.Time) (User, err
 	return usr, nil
 }
 
-// Update replaces a user document in the database.
-func (s Store) Update(ctx context.Context, claims auth.Claims, userID string, uu UpdateUser, now time.Time) error {
+// Update replaces a user document in the database. The update only applies if
+// the user hasn't been modified since it was read, otherwise ErrConflict is
+// returned.
+func (s Store) Update(ctx context.Context, claims auth.Claims, userID string, uu UpdateUser, now time.Time) (err error) {
+	ctx, span := web.AddSpan(ctx, "business.data.store.user.update", attribute.String("user.id", userID))
+	defer span.End()
+	defer func() { spanError(span, err) }()
+
 	if err := validate.CheckID(userID); err != nil {
 		return database.ErrInvalidID
 	}
+
+	// Checked again for callers outside of the API, see Create.
 	if err := validate.Check(uu); err != nil {
 		return fmt.Errorf("validating data: %w", err)
 	}
+	if err := uu.Validate(); err != nil {
+		return fmt.Errorf("validating data: %w", err)
+	}
 
-	usr, err := s.QueryByID(ctx, claims, userID)
+	// The read has to see the latest version of the user since the update is
+	// applied on top of it.
+	usr, err := s.QueryByID(database.ReadYourWrites(ctx), claims, userID)
 	if err != nil {
 		return fmt.Errorf("updating user userID[%s]: %w", userID, err)
 	}
 
+	if uu.Version != nil && *uu.Version != usr.Version {
+		return fmt.Errorf("updating user userID[%s] version[%d]: %w", userID, *uu.Version, database.ErrConflict)
+	}
+
 	if uu.Name != nil {
 		usr.Name = *uu.Name
 	}
@@ -103,6 +138,10 @@ func (s Store) Update(ctx context.Context, claims auth.Claims, userID string, uu
 	}
 	usr.DateUpdated = now
 
+	// The version check makes the update fail when another update got in
+	// between reading the user and writing it back. No row is returned, so
+	// the write goes to the primary and is never retried after a connection
+	// error, when it may already have been applied.
 	const q = `
 	UPDATE
 		users
@@ -111,19 +150,93 @@ func (s Store) Update(ctx context.Context, claims auth.Claims, userID string, uu
 		"email" = :email,
 		"roles" = :roles,
 		"password_hash" = :password_hash,
-		"date_updated" = :date_updated
+		"date_updated" = :date_updated,
+		"version" = "version" + 1
 	WHERE
-		user_id = :user_id`
+		user_id = :user_id AND
+		version = :version`
 
-	if err := database.NamedExecContext(ctx, s.log, s.db, q, usr); err != nil {
+	rows, err := database.NamedExecRows(ctx, s.log, s.db, q, usr)
+	if err != nil {
 		return fmt.Errorf("updating userID[%s]: %w", userID, err)
 	}
+	if rows == 0 {
+		return fmt.Errorf("updating userID[%s] version[%d]: %w", userID, usr.Version, database.ErrConflict)
+	}
 
 	return nil
 }
 
+// Patch applies a patch document to the user and stores the result. The
+// patched user is validated before it is stored.
+func (s Store) Patch(ctx context.Context, claims auth.Claims, userID string, p Patch, now time.Time) (err error) {
+	ctx, span := web.AddSpan(ctx, "business.data.store.user.patch", attribute.String("user.id", userID))
+	defer span.End()
+	defer func() { spanError(span, err) }()
+
+	if err := validate.CheckID(userID); err != nil {
+		return database.ErrInvalidID
+	}
+
+	usr, err := s.QueryByID(database.ReadYourWrites(ctx), claims, userID)
+	if err != nil {
+		return fmt.Errorf("patching user userID[%s]: %w", userID, err)
+	}
+
+	if p.Version != nil && *p.Version != usr.Version {
+		return fmt.Errorf("patching user userID[%s] version[%d]: %w", userID, *p.Version, database.ErrConflict)
+	}
+
+	doc, err := json.Marshal(PatchUser{
+		Name:  usr.Name,
+		Email: usr.Email,
+		Roles: usr.Roles,
+	})
+	if err != nil {
+		return fmt.Errorf("encoding user: %w", err)
+	}
+
+	doc, err = web.ApplyPatch(p.ContentType, doc, p.Document)
+	if err != nil {
+		return fmt.Errorf("patching user userID[%s]: %w", userID, err)
+	}
+
+	// Fields the patch added that aren't part of the document are rejected
+	// rather than silently dropped.
+	var pu PatchUser
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&pu); err != nil {
+		return fmt.Errorf("patching user userID[%s]: %w: %v", userID, web.ErrInvalidPatch, err)
+	}
+
+	if err := validate.Check(pu); err != nil {
+		return fmt.Errorf("validating data: %w", err)
+	}
+	if err := pu.Validate(); err != nil {
+		return fmt.Errorf("validating data: %w", err)
+	}
+
+	// The update is pinned to the version that was patched, so a change made
+	// in the meantime fails with ErrConflict instead of being overwritten.
+	uu := UpdateUser{
+		Name:            &pu.Name,
+		Email:           &pu.Email,
+		Roles:           pu.Roles,
+		Password:        pu.Password,
+		PasswordConfirm: pu.PasswordConfirm,
+		Version:         &usr.Version,
+	}
+
+	return s.Update(ctx, claims, userID, uu, now)
+}
+
 // Delete removes a user from the database.
-func (s Store) Delete(ctx context.Context, claims auth.Claims, userID string) error {
+func (s Store) Delete(ctx context.Context, claims auth.Claims, userID string) (err error) {
+	ctx, span := web.AddSpan(ctx, "business.data.store.user.delete", attribute.String("user.id", userID))
+	defer span.End()
+	defer func() { spanError(span, err) }()
+
 	if err := validate.CheckID(userID); err != nil {
 		return database.ErrInvalidID
 	}
@@ -154,7 +267,13 @@ func (s Store) Delete(ctx context.Context, claims auth.Claims, userID string) er
 
 // [PS] Retrieve operation. Method 1
 // Query retrieves a list of existing users from the database.
-func (s Store) Query(ctx context.Context, pageNumber int, rowsPerPage int) ([]User, error) {
+func (s Store) Query(ctx context.Context, pageNumber int, rowsPerPage int) (_ []User, err error) {
+	ctx, span := web.AddSpan(ctx, "business.data.store.user.query",
+		attribute.Int("page.number", pageNumber),
+		attribute.Int("page.rows", rowsPerPage),
+	)
+	defer span.End()
+	defer func() { spanError(span, err) }()
 
 	// [PS] constructing the struct for the name substitution used in the query later
 	data := struct {
@@ -185,9 +304,40 @@ func (s Store) Query(ctx context.Context, pageNumber int, rowsPerPage int) ([]Us
 	return users, nil
 }
 
+// QueryAll calls fn with every user in the database without holding them in
+// memory, for exports of the whole table.
+func (s Store) QueryAll(ctx context.Context, fn func(usr User) error) (err error) {
+	ctx, span := web.AddSpan(ctx, "business.data.store.user.queryall")
+	defer span.End()
+	defer func() { spanError(span, err) }()
+
+	const q = `
+	SELECT
+		*
+	FROM
+		users
+	ORDER BY
+		user_id`
+
+	var usr User
+	f := func() error {
+		return fn(usr)
+	}
+
+	if err := database.NamedQueryEach(ctx, s.log, s.db, q, struct{}{}, &usr, f); err != nil {
+		return fmt.Errorf("selecting users: %w", err)
+	}
+
+	return nil
+}
+
 // [PS] Retrieve operation. Method 2
 // QueryByID gets the specified user from the database.
-func (s Store) QueryByID(ctx context.Context, claims auth.Claims, userID string) (User, error) {
+func (s Store) QueryByID(ctx context.Context, claims auth.Claims, userID string) (_ User, err error) {
+	ctx, span := web.AddSpan(ctx, "business.data.store.user.querybyid", attribute.String("user.id", userID))
+	defer span.End()
+	defer func() { spanError(span, err) }()
+
 	if err := validate.CheckID(userID); err != nil {
 		return User{}, database.ErrInvalidID
 	}
@@ -223,7 +373,10 @@ func (s Store) QueryByID(ctx context.Context, claims auth.Claims, userID string)
 }
 
 // QueryByEmail gets the specified user from the database by email.
-func (s Store) QueryByEmail(ctx context.Context, claims auth.Claims, email string) (User, error) {
+func (s Store) QueryByEmail(ctx context.Context, claims auth.Claims, email string) (_ User, err error) {
+	ctx, span := web.AddSpan(ctx, "business.data.store.user.querybyemail")
+	defer span.End()
+	defer func() { spanError(span, err) }()
 
 	// Add Email Validate function in validate
 	// if err := validate.Email(email); err != nil {
@@ -251,6 +404,7 @@ func (s Store) QueryByEmail(ctx context.Context, claims auth.Claims, email strin
 		}
 		return User{}, fmt.Errorf("selecting email[%q]: %w", email, err)
 	}
+	span.SetAttributes(attribute.String("user.id", usr.ID))
 
 	// If you are not an admin and looking to retrieve someone other than yourself.
 	if !claims.Authorized(auth.RoleAdmin) && claims.Subject != usr.ID {
@@ -263,7 +417,11 @@ func (s Store) QueryByEmail(ctx context.Context, claims auth.Claims, email strin
 // Authenticate finds a user by their email and verifies their password. On
 // success it returns a Claims User representing this user. The claims can be
 // used to generate a token for future authentication.
-func (s Store) Authenticate(ctx context.Context, now time.Time, email, password string) (auth.Claims, error) {
+func (s Store) Authenticate(ctx context.Context, now time.Time, email, password string) (_ auth.Claims, err error) {
+	ctx, span := web.AddSpan(ctx, "business.data.store.user.authenticate")
+	defer span.End()
+	defer func() { spanError(span, err) }()
+
 	data := struct {
 		Email string `db:"email"`
 	}{
@@ -286,9 +444,11 @@ func (s Store) Authenticate(ctx context.Context, now time.Time, email, password
 		return auth.Claims{}, fmt.Errorf("selecting user[%q]: %w", email, err)
 	}
 
+	span.SetAttributes(attribute.String("user.id", usr.ID))
+
 	// Compare the provided password with the saved hash. Use the bcrypt
 	// comparison function so it is cryptographically secure.
-	if err := bcrypt.CompareHashAndPassword(usr.PasswordHash, []byte(password)); err != nil {
+	if err := comparePassword(ctx, usr.PasswordHash, password); err != nil {
 		return auth.Claims{}, database.ErrAuthenticationFailure
 	}
 
@@ -305,3 +465,44 @@ func (s Store) Authenticate(ctx context.Context, now time.Time, email, password
 	}
 	return claims, nil
 }
+
+// comparePassword compares a bcrypt hash with its possible plaintext
+// equivalent. The comparison is deliberately slow so it gets its own span.
+func comparePassword(ctx context.Context, hash []byte, password string) (err error) {
+	_, span := web.AddSpan(ctx, "business.data.store.user.comparepassword")
+	defer span.End()
+	defer func() { spanError(span, err) }()
+
+	return bcrypt.CompareHashAndPassword(hash, []byte(password))
+}
+
+// spanError records an unexpected error against the span. Outcomes the store
+// is expected to report, like a user that doesn't exist or a failed login,
+// are added as an event instead so normal 4xx traffic doesn't show up as
+// failed spans.
+func spanError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+
+	var fieldErrors validate.FieldErrors
+	switch {
+	case errors.Is(err, database.ErrNotFound),
+		errors.Is(err, database.ErrInvalidID),
+		errors.Is(err, database.ErrForbidden),
+		errors.Is(err, database.ErrConflict),
+		errors.Is(err, database.ErrAuthenticationFailure),
+		errors.Is(err, database.ErrDuplicate),
+		errors.Is(err, database.ErrReference),
+		errors.Is(err, database.ErrCheck),
+		errors.Is(err, database.ErrNotNull),
+		errors.Is(err, web.ErrInvalidPatch),
+		errors.Is(err, web.ErrPatchTestFailed),
+		errors.Is(err, bcrypt.ErrMismatchedHashAndPassword),
+		errors.As(err, &fieldErrors):
+		span.AddEvent(err.Error())
+
+	default:
+		web.SpanError(span, err)
+	}
+}
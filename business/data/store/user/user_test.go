@@ -96,6 +96,14 @@ func TestUser(t *testing.T) {
 			}
 			t.Logf("\t%s\tTest %d:\tShould be able to update user.", tests.Success, testID)
 
+			// Updating against the version that was read before the update
+			// has to be rejected.
+			upd.Version = &usr.Version
+			if err := store.Update(ctx, claims, usr.ID, upd, now); !errors.Is(err, database.ErrConflict) {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to update a stale user : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to update a stale user.", tests.Success, testID)
+
 			// [PS] After the update, query the db to check if update was successful
 			saved, err = store.QueryByEmail(ctx, claims, *upd.Email)
 			if err != nil {
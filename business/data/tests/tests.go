@@ -64,6 +64,12 @@ func NewUnit(t *testing.T, dbc DBContainer) (*zap.SugaredLogger, *sqlx.DB, func(
 		t.Fatalf("Opening database connection: %v", err)
 	}
 
+	// [PS] Logger for the testing
+	log, err := logger.New("TEST")
+	if err != nil {
+		t.Fatalf("logger error: %s", err)
+	}
+
 	t.Log("Waiting for database to be ready ...")
 
 	// [PS] Fill the entries in the database (Migrate and seeding)
@@ -78,18 +84,12 @@ func NewUnit(t *testing.T, dbc DBContainer) (*zap.SugaredLogger, *sqlx.DB, func(
 	}
 
 	// [PS] If migrate fails, dump the logs and stop the container
-	if err := schema.Seed(ctx, db); err != nil {
+	if err := schema.Seed(ctx, log, db, schema.SeedTest); err != nil {
 		docker.DumpContainerLogs(t, c.ID)
 		docker.StopContainer(t, c.ID)
 		t.Fatalf("Seeding error: %s", err)
 	}
 
-	// [PS] Logger for the testing
-	log, err := logger.New("TEST")
-	if err != nil {
-		t.Fatalf("logger error: %s", err)
-	}
-
 	// teardown is the function that should be invoked when the caller is done
 	// with the database.
 	teardown := func() {
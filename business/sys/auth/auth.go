@@ -2,11 +2,21 @@
 package auth
 
 import (
+	"context"
 	"crypto/rsa"
 	"errors"
 	"fmt"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/piyush-saurabh/go-service/business/sys/validate"
+	"github.com/piyush-saurabh/go-service/foundation/web"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Set of errors returned when validating tokens.
+var (
+	ErrInvalidToken = validate.NewError(validate.CodeTokenInvalid, "invalid token")
+	ErrTokenExpired = validate.NewError(validate.CodeTokenExpired, "token has expired")
 )
 
 // KeyLookup declares a method set of behavior for looking up
@@ -95,16 +105,35 @@ func (a *Auth) GenerateToken(claims Claims) (string, error) {
 // [PS] Helper functions
 // ValidateToken recreates the Claims that were used to generate a token. It
 // verifies that the token was signed using our key.
-func (a *Auth) ValidateToken(tokenStr string) (Claims, error) {
+func (a *Auth) ValidateToken(ctx context.Context, tokenStr string) (Claims, error) {
+	_, span := web.AddSpan(ctx, "business.sys.auth.validatetoken")
+	defer span.End()
+
 	var claims Claims
 	token, err := a.parser.ParseWithClaims(tokenStr, &claims, a.keyFunc)
 	if err != nil {
-		return Claims{}, fmt.Errorf("parsing token: %w", err)
+
+		// Expired tokens are told apart so clients know to request a new one.
+		kind := ErrInvalidToken
+		var vErr *jwt.ValidationError
+		if errors.As(err, &vErr) && vErr.Errors&jwt.ValidationErrorExpired != 0 {
+			kind = ErrTokenExpired
+		}
+		err = fmt.Errorf("parsing token: %w: %v", kind, err)
+		web.SpanError(span, err)
+		return Claims{}, err
 	}
 
 	if !token.Valid {
-		return Claims{}, errors.New("invalid token")
+		err := ErrInvalidToken
+		web.SpanError(span, err)
+		return Claims{}, err
 	}
 
+	span.SetAttributes(
+		attribute.String("user.id", claims.Subject),
+		attribute.StringSlice("user.roles", claims.Roles),
+	)
+
 	return claims, nil
 }
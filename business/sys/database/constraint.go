@@ -0,0 +1,105 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/piyush-saurabh/go-service/business/sys/validate"
+)
+
+// Set of error variables for constraint violations. They are matched with
+// errors.Is against the *ConstraintError returned by the helper functions.
+var (
+	ErrDuplicate = validate.NewError(validate.CodeDuplicateValue, "duplicate value")
+	ErrReference = validate.NewError(validate.CodeInvalidReference, "invalid reference")
+	ErrCheck     = validate.NewError(validate.CodeValueOutOfRange, "value out of range")
+	ErrNotNull   = validate.NewError(validate.CodeMissingValue, "missing value")
+)
+
+// ConstraintError is returned when a query violates a constraint defined in
+// the schema. It identifies the constraint and, when Postgres reports it, the
+// column that caused the violation.
+type ConstraintError struct {
+	Err        error // one of ErrDuplicate, ErrReference, ErrCheck or ErrNotNull
+	Table      string
+	Column     string
+	Constraint string
+}
+
+// Error implements the error interface.
+func (err *ConstraintError) Error() string {
+	switch {
+	case err.Column != "":
+		return fmt.Sprintf("%s for %s (%s)", err.Err, err.Column, err.Constraint)
+	case err.Constraint != "":
+		return fmt.Sprintf("%s (%s)", err.Err, err.Constraint)
+	}
+	return err.Err.Error()
+}
+
+// Is reports if the target is the kind of violation. Unwrap is deliberately
+// not implemented so validate.Cause stops at the ConstraintError and the
+// constraint and column stay available.
+func (err *ConstraintError) Is(target error) bool {
+	return target == err.Err
+}
+
+// Code returns the code of the kind of violation.
+func (err *ConstraintError) Code() validate.Code {
+	return validate.CodeOf(err.Err)
+}
+
+// constraintError translates a Postgres integrity constraint violation into a
+// ConstraintError. Any other error is returned unchanged.
+func constraintError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	var kind error
+	switch pqErr.Code.Name() {
+	case "unique_violation":
+		kind = ErrDuplicate
+	case "foreign_key_violation":
+		kind = ErrReference
+	case "check_violation":
+		kind = ErrCheck
+	case "not_null_violation":
+		kind = ErrNotNull
+	default:
+		return err
+	}
+
+	column := pqErr.Column
+	if column == "" {
+		column = detailColumn(pqErr.Detail)
+	}
+
+	return &ConstraintError{
+		Err:        kind,
+		Table:      pqErr.Table,
+		Column:     column,
+		Constraint: pqErr.Constraint,
+	}
+}
+
+// detailColumn extracts the column from details like
+// "Key (email)=(a@example.com) already exists.". Multi-column keys are
+// returned as they are listed.
+func detailColumn(detail string) string {
+	const prefix = "Key ("
+
+	if !strings.HasPrefix(detail, prefix) {
+		return ""
+	}
+
+	end := strings.Index(detail, ")=(")
+	if end == -1 {
+		return ""
+	}
+
+	return detail[len(prefix):end]
+}
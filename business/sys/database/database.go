@@ -3,27 +3,31 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"net"
 	"net/url"
 	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq" // Calls init function.
+	"github.com/piyush-saurabh/go-service/business/sys/validate"
 	"github.com/piyush-saurabh/go-service/foundation/web"
-	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
 // Set of error variables for CRUD operations.
 var (
-	ErrNotFound              = errors.New("not found")
-	ErrInvalidID             = errors.New("ID isi not in its proper form")
-	ErrAuthenticationFailure = errors.New("authentication failed")
-	ErrForbidden             = errors.New("attempted action is not allowed")
+	ErrNotFound              = validate.NewError(validate.CodeNotFound, "not found")
+	ErrInvalidID             = validate.NewError(validate.CodeInvalidID, "ID is not in its proper form")
+	ErrAuthenticationFailure = validate.NewError(validate.CodeAuthenticationFailed, "authentication failed")
+	ErrForbidden             = validate.NewError(validate.CodeForbidden, "attempted action is not allowed")
+	ErrConflict              = validate.NewError(validate.CodeVersionConflict, "data has been modified since it was read")
 )
 
 // Config is the required properties to use the database.
@@ -35,36 +39,126 @@ type Config struct {
 	MaxIdleConns int
 	MaxOpenConns int
 	DisableTLS   bool
+
+	// Port is added to Host when Host doesn't carry a port of its own.
+	Port int
+
+	// TLSMode is the Postgres sslmode: disable, require, verify-ca or
+	// verify-full. When empty DisableTLS picks between disable and require.
+	// CACertFile is the CA bundle used to verify the server, CertFile and
+	// KeyFile the client certificate for certificate authentication.
+	TLSMode    string
+	CACertFile string
+	CertFile   string
+	KeyFile    string
+
+	// Session settings applied to every connection.
+	SearchPath       string
+	ApplicationName  string
+	ConnectTimeout   time.Duration
+	StatementTimeout time.Duration
+
+	// DeadlineTimeout makes the handle returned by OpenDB limit every
+	// statement to the time left before the deadline of its context, so the
+	// database stops working on a request the caller has given up on.
+	DeadlineTimeout bool
+
+	// Replicas lists the read replicas used by OpenDB. Each entry is either
+	// the host of a replica sharing the settings above or a full postgres URL.
+	Replicas []string
+
+	// ReplicaRetry is how long a failed replica is skipped before reads are
+	// sent to it again. Zero uses DefaultReplicaRetry.
+	ReplicaRetry time.Duration
+
+	// BreakerThreshold is the number of consecutive connection failures that
+	// open the circuit breaker of OpenDB, and BreakerCooldown how long it stays
+	// open before the database is probed again. Zero uses the defaults.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
 }
 
 // [PS] Helper function
 // Open knows how to open a database connection based on the configuration.
 func Open(cfg Config) (*sqlx.DB, error) {
-	sslMode := "require"
-	if cfg.DisableTLS {
+	dsn, err := dsn(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sqlx.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+
+	return db, nil
+}
+
+// dsn builds the connection string for the configuration.
+func dsn(cfg Config) (string, error) {
+	sslMode := cfg.TLSMode
+	switch {
+	case sslMode != "":
+	case cfg.DisableTLS:
 		sslMode = "disable"
+	default:
+		sslMode = "require"
+	}
+
+	switch sslMode {
+	case "disable", "require", "verify-ca", "verify-full":
+	default:
+		return "", fmt.Errorf("invalid TLS mode %q", sslMode)
 	}
 
 	q := make(url.Values)
 	q.Set("sslmode", sslMode)
 	q.Set("timezone", "utc")
 
+	if cfg.CACertFile != "" {
+		q.Set("sslrootcert", cfg.CACertFile)
+	}
+	if cfg.CertFile != "" {
+		q.Set("sslcert", cfg.CertFile)
+	}
+	if cfg.KeyFile != "" {
+		q.Set("sslkey", cfg.KeyFile)
+	}
+	if cfg.SearchPath != "" {
+		q.Set("search_path", cfg.SearchPath)
+	}
+	if cfg.ApplicationName != "" {
+		q.Set("application_name", cfg.ApplicationName)
+	}
+	if cfg.ConnectTimeout > 0 {
+
+		// The driver takes whole seconds, round up so a timeout below a
+		// second doesn't turn into no timeout at all.
+		secs := (cfg.ConnectTimeout + time.Second - 1) / time.Second
+		q.Set("connect_timeout", strconv.Itoa(int(secs)))
+	}
+	if cfg.StatementTimeout > 0 {
+		q.Set("statement_timeout", strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10))
+	}
+
+	host := cfg.Host
+	if cfg.Port != 0 {
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, strconv.Itoa(cfg.Port))
+		}
+	}
+
 	u := url.URL{
 		Scheme:   "postgres",
 		User:     url.UserPassword(cfg.User, cfg.Password),
-		Host:     cfg.Host,
+		Host:     host,
 		Path:     cfg.Name,
 		RawQuery: q.Encode(),
 	}
 
-	db, err := sqlx.Open("postgres", u.String())
-	if err != nil {
-		return nil, err
-	}
-	db.SetMaxIdleConns(cfg.MaxIdleConns)
-	db.SetMaxOpenConns(cfg.MaxOpenConns)
-
-	return db, nil
+	return u.String(), nil
 }
 
 // [PS] used for readiness probe in k8s
@@ -99,23 +193,87 @@ func StatusCheck(ctx context.Context, db *sqlx.DB) error {
 	return db.QueryRowContext(ctx, q).Scan(&tmp)
 }
 
+// WithAdvisoryLock runs the function while holding a Postgres session level
+// advisory lock for the specified key. Callers on other connections, including
+// other instances of the service, block until the lock is released, so only
+// one of them runs the function at a time.
+//
+// The connection holding the lock is taken from the pool for as long as the
+// function runs, so the function has to get its connections elsewhere. A pool
+// limited to a single connection would deadlock and is rejected up front.
+func WithAdvisoryLock(ctx context.Context, db *sqlx.DB, key int64, fn func() error) error {
+	if max := db.Stats().MaxOpenConnections; max > 0 && max < 2 {
+		return fmt.Errorf("advisory lock requires at least 2 open connections, pool allows %d", max)
+	}
+
+	// Session level locks belong to a connection so a single connection has
+	// to be held for both the lock and the unlock.
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return fmt.Errorf("acquiring connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, key); err != nil {
+		return fmt.Errorf("acquiring advisory lock: %w", err)
+	}
+
+	// Unlock with a fresh context since the caller's context may be done.
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, key)
+
+	return fn()
+}
+
 // NamedExecContext is a helper function to execute a CUD operation with
 // logging and tracing.
 func NamedExecContext(ctx context.Context, log *zap.SugaredLogger, db sqlx.ExtContext, query string, data interface{}) error {
+	_, err := namedExec(ctx, log, db, "database.NamedExecContext", query, data)
+	return err
+}
+
+// NamedExecRows is a helper function to execute a CUD operation with logging
+// and tracing that returns the number of rows affected. Conditional writes,
+// like an update pinned to a version, check the count instead of returning a
+// row so the write is never run again after a connection error.
+func NamedExecRows(ctx context.Context, log *zap.SugaredLogger, db sqlx.ExtContext, query string, data interface{}) (int64, error) {
+	return namedExec(ctx, log, db, "database.NamedExecRows", query, data)
+}
+
+// namedExec executes the statement, retrying it only when it is known to not
+// have been applied.
+func namedExec(ctx context.Context, log *zap.SugaredLogger, db sqlx.ExtContext, name string, query string, data interface{}) (int64, error) {
 	q := queryString(query, data)
-	log.Infow("database.NamedExecContext", "traceid", web.GetTraceID(ctx), "query", q)
+	log.Debugw(name, "traceid", web.GetTraceID(ctx), "query", q)
 
 	// [PS] Tracing
-	ctx, span := otel.GetTracerProvider().Tracer("").Start(ctx, "database.query")
-	span.SetAttributes(attribute.String("query", q))
+	ctx, span := web.AddSpan(ctx, "database.query", attribute.String("query", q))
 	defer span.End()
 	// [PS] at the end of the trace, it will give info of how long function took to run
 
-	if _, err := sqlx.NamedExecContext(ctx, db, query, data); err != nil {
+	var result sql.Result
+	exec := func(db sqlx.ExtContext) error {
+		var err error
+		result, err = sqlx.NamedExecContext(ctx, db, query, data)
 		return err
 	}
 
-	return nil
+	f := func() error {
+		return withDeadlineTimeout(ctx, db, db, exec)
+	}
+
+	if err := retry(ctx, log, breakerFor(db), execRetryable(db), f); err != nil {
+		web.SpanError(span, err)
+		return 0, constraintError(err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		web.SpanError(span, err)
+		return 0, err
+	}
+	span.SetAttributes(attribute.Int64("db.rows_affected", rows))
+
+	return rows, nil
 }
 
 // [PS] Read operation which returns "multiple" results
@@ -123,11 +281,10 @@ func NamedExecContext(ctx context.Context, log *zap.SugaredLogger, db sqlx.ExtCo
 // collection of data to be unmarshaled into a slice.
 func NamedQuerySlice(ctx context.Context, log *zap.SugaredLogger, db sqlx.ExtContext, query string, data interface{}, dest interface{}) error {
 	q := queryString(query, data)
-	log.Infow("database.NamedQuerySlice", "traceid", web.GetTraceID(ctx), "query", q)
+	log.Debugw("database.NamedQuerySlice", "traceid", web.GetTraceID(ctx), "query", q)
 
 	// [PS] Tracing
-	ctx, span := otel.GetTracerProvider().Tracer("").Start(ctx, "database.query")
-	span.SetAttributes(attribute.String("query", q))
+	ctx, span := web.AddSpan(ctx, "database.query", attribute.String("query", q))
 	defer span.End()
 	// [PS] at the end of the trace, it will give info of how long function took to run
 
@@ -137,53 +294,210 @@ func NamedQuerySlice(ctx context.Context, log *zap.SugaredLogger, db sqlx.ExtCon
 		return errors.New("must provide a pointer to a slice")
 	}
 
-	rows, err := sqlx.NamedQueryContext(ctx, db, query, data)
-	if err != nil {
-		return err
+	// Reads may be routed to a replica and retried against the primary, so
+	// the slice is reset on every attempt.
+	slice := val.Elem()
+	f := func(db sqlx.ExtContext, node string) error {
+		span.SetAttributes(attribute.String("db.node", node))
+		slice.Set(reflect.MakeSlice(slice.Type(), 0, 0))
+
+		rows, err := sqlx.NamedQueryContext(ctx, db, query, data)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			v := reflect.New(slice.Type().Elem())
+			if err := rows.StructScan(v.Interface()); err != nil {
+				return err
+			}
+			slice.Set(reflect.Append(slice, v.Elem()))
+		}
+
+		return rows.Err()
 	}
-	defer rows.Close()
 
-	slice := val.Elem()
-	for rows.Next() {
-		v := reflect.New(slice.Type().Elem())
-		if err := rows.StructScan(v.Interface()); err != nil {
+	read := func() error {
+		return route(ctx, log, db, f)
+	}
+
+	if err := retry(ctx, log, breakerFor(db), queryRetryable(db), read); err != nil {
+		web.SpanError(span, err)
+		return constraintError(err)
+	}
+	span.SetAttributes(attribute.Int("db.rows_returned", slice.Len()))
+
+	return nil
+}
+
+// NamedQueryEach is a helper function for executing queries that return a
+// collection of data too large to hold in memory. Every row is unmarshaled
+// into dest, which must be a pointer to a struct, and fn is called before the
+// next row is read. The query is only retried or failed over until the first
+// row is handed to fn.
+func NamedQueryEach(ctx context.Context, log *zap.SugaredLogger, db sqlx.ExtContext, query string, data interface{}, dest interface{}, fn func() error) error {
+	q := queryString(query, data)
+	log.Debugw("database.NamedQueryEach", "traceid", web.GetTraceID(ctx), "query", q)
+
+	ctx, span := web.AddSpan(ctx, "database.query", attribute.String("query", q))
+	defer span.End()
+
+	var rowsReturned int
+	f := func(db sqlx.ExtContext, node string) error {
+		span.SetAttributes(attribute.String("db.node", node))
+
+		rows, err := sqlx.NamedQueryContext(ctx, db, query, data)
+		if err != nil {
 			return err
 		}
-		slice.Set(reflect.Append(slice, v.Elem()))
+		defer rows.Close()
+
+		for rows.Next() {
+			if err := rows.StructScan(dest); err != nil {
+				return err
+			}
+			rowsReturned++
+			if err := fn(); err != nil {
+				return &streamError{err}
+			}
+		}
+
+		if err := rows.Err(); err != nil && rowsReturned > 0 {
+			return &streamError{err}
+		}
+		return rows.Err()
+	}
+
+	read := func() error {
+		return route(ctx, log, db, f)
 	}
 
+	if err := retry(ctx, log, breakerFor(db), queryRetryable(db), read); err != nil {
+		span.SetAttributes(attribute.Int("db.rows_returned", rowsReturned))
+		var serr *streamError
+		if errors.As(err, &serr) {
+			err = serr.err
+		}
+		web.SpanError(span, err)
+		return constraintError(err)
+	}
+	span.SetAttributes(attribute.Int("db.rows_returned", rowsReturned))
+
 	return nil
 }
 
+// streamError marks an error that happened after rows were handed to the
+// caller. It hides the error from Classify so the query isn't retried or
+// failed over, which would hand the same rows to the caller again.
+type streamError struct {
+	err error
+}
+
+// Error implements the error interface.
+func (err *streamError) Error() string {
+	return err.err.Error()
+}
+
 // [PS] Read operation which returns "single" results
 // NamedQueryStruct is a helper function for executing queries that return a
 // single value to be unmarshalled into a struct type.
 func NamedQueryStruct(ctx context.Context, log *zap.SugaredLogger, db sqlx.ExtContext, query string, data interface{}, dest interface{}) error {
 	q := queryString(query, data)
-	log.Infow("database.NamedQueryStruct", "traceid", web.GetTraceID(ctx), "query", q)
+	log.Debugw("database.NamedQueryStruct", "traceid", web.GetTraceID(ctx), "query", q)
 
 	// [PS] Tracing
 	// Start a new span with the name "database.query"
-	ctx, span := otel.GetTracerProvider().Tracer("").Start(ctx, "database.query")
-	span.SetAttributes(attribute.String("query", q))
+	ctx, span := web.AddSpan(ctx, "database.query", attribute.String("query", q))
 	defer span.End()
 	// [PS] at the end of the trace, it will give info of how long function took to run
 
-	rows, err := sqlx.NamedQueryContext(ctx, db, query, data)
+	f := func(db sqlx.ExtContext, node string) error {
+		span.SetAttributes(attribute.String("db.node", node))
+
+		rows, err := sqlx.NamedQueryContext(ctx, db, query, data)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		if !rows.Next() {
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			return ErrNotFound
+		}
+
+		return rows.StructScan(dest)
+	}
+
+	read := func() error {
+		return route(ctx, log, db, f)
+	}
+
+	if err := retry(ctx, log, breakerFor(db), queryRetryable(db), read); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			span.SetAttributes(attribute.Int("db.rows_returned", 0))
+			return err
+		}
+		web.SpanError(span, err)
+		return constraintError(err)
+	}
+	span.SetAttributes(attribute.Int("db.rows_returned", 1))
+
+	return nil
+}
+
+// withDeadlineTimeout runs the operation against db limited to the time left
+// before the context deadline when handle has DeadlineTimeout enabled. The
+// statement_timeout can only be scoped to a transaction, so outside of one the
+// operation is run in a transaction of its own.
+func withDeadlineTimeout(ctx context.Context, handle sqlx.ExtContext, db sqlx.ExtContext, op func(db sqlx.ExtContext) error) error {
+	rdb, ok := handle.(*DB)
+	if !ok || !rdb.deadlineTimeout {
+		return op(db)
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return op(db)
+	}
+
+	// Postgres treats a timeout of zero as no timeout.
+	ms := time.Until(deadline).Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	set := fmt.Sprintf("SET LOCAL statement_timeout = %d", ms)
+
+	if tx, ok := db.(*sqlx.Tx); ok {
+		if _, err := tx.ExecContext(ctx, set); err != nil {
+			return err
+		}
+		return op(tx)
+	}
+
+	b, ok := db.(Beginner)
+	if !ok {
+		return op(db)
+	}
+
+	tx, err := b.BeginTxx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
 
-	if !rows.Next() {
-		return ErrNotFound
+	if _, err := tx.ExecContext(ctx, set); err != nil {
+		tx.Rollback()
+		return err
 	}
 
-	if err := rows.StructScan(dest); err != nil {
+	if err := op(tx); err != nil {
+		tx.Rollback()
 		return err
 	}
 
-	return nil
+	return tx.Commit()
 }
 
 // [PS] Helper function for generating the query string for logging
@@ -0,0 +1,213 @@
+package database
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// DefaultReplicaRetry is how long a replica that failed is left alone before
+// reads are sent to it again.
+const DefaultReplicaRetry = 30 * time.Second
+
+// DB routes queries between a primary database and a set of read replicas.
+// The primary is embedded so anything run directly against DB, including
+// NamedExecContext and transactions, goes to the primary. NamedQuerySlice and
+// NamedQueryStruct send their reads to a healthy replica instead, falling
+// back to the primary when no replica is available.
+type DB struct {
+	*sqlx.DB
+	replicas []*replica
+	retry    time.Duration
+	next     uint32
+	breaker  *Breaker
+
+	deadlineTimeout bool
+}
+
+// replica is a read replica along with its health.
+type replica struct {
+	db        *sqlx.DB
+	host      string
+	downUntil int64 // unix nanoseconds, accessed atomically
+}
+
+// NewDB constructs a DB that routes reads between the replicas and writes to
+// the primary. With no replicas every query goes to the primary. Queries go
+// through a circuit breaker with the default settings.
+func NewDB(primary *sqlx.DB, replicas ...*sqlx.DB) *DB {
+	db := DB{
+		DB:      primary,
+		retry:   DefaultReplicaRetry,
+		breaker: NewBreaker(DefaultBreakerThreshold, DefaultBreakerCooldown),
+	}
+	for _, r := range replicas {
+		db.replicas = append(db.replicas, &replica{db: r})
+	}
+
+	return &db
+}
+
+// OpenDB opens the primary database and every replica in the configuration.
+func OpenDB(cfg Config) (*DB, error) {
+	primary, err := Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	db := NewDB(primary)
+	if cfg.ReplicaRetry > 0 {
+		db.retry = cfg.ReplicaRetry
+	}
+	db.breaker = NewBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown)
+	db.deadlineTimeout = cfg.DeadlineTimeout
+
+	for _, value := range cfg.Replicas {
+		dsn, err := replicaDSN(cfg, value)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+
+		rdb, err := sqlx.Open("postgres", dsn)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		rdb.SetMaxIdleConns(cfg.MaxIdleConns)
+		rdb.SetMaxOpenConns(cfg.MaxOpenConns)
+
+		db.replicas = append(db.replicas, &replica{db: rdb, host: replicaHost(dsn)})
+	}
+
+	return db, nil
+}
+
+// Close closes the primary and every replica.
+func (db *DB) Close() error {
+	err := db.DB.Close()
+	for _, r := range db.replicas {
+		if rerr := r.db.Close(); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+// Breaker returns the circuit breaker guarding the database.
+func (db *DB) Breaker() *Breaker {
+	return db.breaker
+}
+
+// Replicas returns the replica connections so their health can be checked.
+func (db *DB) Replicas() []*sqlx.DB {
+	dbs := make([]*sqlx.DB, len(db.replicas))
+	for i, r := range db.replicas {
+		dbs[i] = r.db
+	}
+	return dbs
+}
+
+// reader picks the next healthy replica in round robin order. It returns nil
+// when the read has to go to the primary.
+func (db *DB) reader(ctx context.Context) *replica {
+	if len(db.replicas) == 0 || readYourWrites(ctx) {
+		return nil
+	}
+
+	now := time.Now().UnixNano()
+	start := atomic.AddUint32(&db.next, 1)
+	for i := 0; i < len(db.replicas); i++ {
+		r := db.replicas[(int(start)+i)%len(db.replicas)]
+		if atomic.LoadInt64(&r.downUntil) <= now {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// markDown takes the replica out of rotation until the retry period passes.
+func (db *DB) markDown(r *replica) {
+	atomic.StoreInt64(&r.downUntil, time.Now().Add(db.retry).UnixNano())
+}
+
+// =============================================================================
+
+// ctxKey represents the type of value for the context key.
+type ctxKey int
+
+// readYourWritesKey is used to store/retrieve the read-your-writes option.
+const readYourWritesKey ctxKey = 1
+
+// ReadYourWrites returns a context whose reads are sent to the primary, so
+// they see writes made earlier in the request that replicas may not have
+// received yet.
+func ReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readYourWritesKey, true)
+}
+
+// readYourWrites reports if reads for the context must go to the primary.
+func readYourWrites(ctx context.Context) bool {
+	v, ok := ctx.Value(readYourWritesKey).(bool)
+	return ok && v
+}
+
+// route runs the read against a replica when db is a *DB. If the replica
+// can't be reached it is taken out of rotation and the read is run again
+// against the primary. The read is told which node it runs against.
+func route(ctx context.Context, log *zap.SugaredLogger, db sqlx.ExtContext, read func(db sqlx.ExtContext, node string) error) error {
+	run := func(node sqlx.ExtContext, name string) error {
+		f := func(node sqlx.ExtContext) error {
+			return read(node, name)
+		}
+		return withDeadlineTimeout(ctx, db, node, f)
+	}
+
+	rdb, ok := db.(*DB)
+	if !ok {
+		return run(db, "primary")
+	}
+
+	r := rdb.reader(ctx)
+	if r == nil {
+		return run(rdb.DB, "primary")
+	}
+
+	err := run(r.db, "replica")
+	if err == nil || ctx.Err() != nil || Classify(err) != ClassConnection {
+		return err
+	}
+
+	log.Warnw("database replica unavailable", "host", r.host, "ERROR", err)
+	rdb.markDown(r)
+
+	return run(rdb.DB, "primary")
+}
+
+// replicaDSN builds the connection string for a replica. A value holding a
+// full postgres URL is used as is, otherwise it is taken as the host of a
+// replica that shares the rest of the primary's configuration.
+func replicaDSN(cfg Config, value string) (string, error) {
+	if strings.Contains(value, "://") {
+		return value, nil
+	}
+
+	cfg.Host = value
+	return dsn(cfg)
+}
+
+// replicaHost returns the host of the replica for logging without exposing
+// the credentials in its connection string.
+func replicaHost(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
@@ -0,0 +1,310 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/piyush-saurabh/go-service/business/sys/validate"
+	"github.com/piyush-saurabh/go-service/foundation/web"
+	"go.uber.org/zap"
+)
+
+// ErrCircuitOpen is returned without touching the database while the circuit
+// breaker considers the database to be down.
+var ErrCircuitOpen = validate.NewError(validate.CodeUnavailable, "database unavailable: circuit open")
+
+// Class groups database errors by how the caller can react to them.
+type Class int
+
+// Set of error classes.
+const (
+	ClassOther         Class = iota // not transient, retrying won't help
+	ClassConnection                 // the database could not be reached
+	ClassSerialization              // serialization failure, 40001
+	ClassDeadlock                   // deadlock detected, 40P01
+)
+
+// Classify reports the class of the error using the lib/pq error codes.
+func Classify(err error) Class {
+	if err == nil {
+		return ClassOther
+	}
+
+	if errors.Is(err, driver.ErrBadConn) {
+		return ClassConnection
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code == "40001":
+			return ClassSerialization
+		case pqErr.Code == "40P01":
+			return ClassDeadlock
+		case pqErr.Code.Class() == "08": // connection exception
+			return ClassConnection
+		case strings.HasPrefix(string(pqErr.Code), "57P"): // shutting down or starting up
+			return ClassConnection
+		case pqErr.Code == "53300": // too many connections
+			return ClassConnection
+		}
+		return ClassOther
+	}
+
+	// A cancelled or timed out context says nothing about the database, and
+	// context.DeadlineExceeded would otherwise pass as a net.Error timeout.
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return ClassOther
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ClassConnection
+	}
+
+	return ClassOther
+}
+
+// =============================================================================
+
+// Set of defaults for retrying transient errors.
+const (
+	maxAttempts = 3
+	retryWait   = 50 * time.Millisecond
+)
+
+// Set of defaults for the circuit breaker.
+const (
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 10 * time.Second
+)
+
+// Breaker is a circuit breaker that opens after a number of consecutive
+// connection failures. While open, queries fail fast with ErrCircuitOpen.
+// Once the cooldown passes a single query is let through to probe the
+// database, and its result decides if the circuit closes or stays open.
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewBreaker constructs a breaker that opens after threshold consecutive
+// connection failures and probes the database again after the cooldown.
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	if threshold <= 0 {
+		threshold = DefaultBreakerThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultBreakerCooldown
+	}
+
+	return &Breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// Allow returns ErrCircuitOpen if the query should not be sent to the
+// database. A nil breaker allows everything.
+func (b *Breaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return nil
+	}
+	if b.probing || time.Since(b.openedAt) < b.cooldown {
+		return ErrCircuitOpen
+	}
+
+	b.probing = true
+	return nil
+}
+
+// Record updates the breaker with the result of a query. Only connection
+// errors count as failures, any other result means the database answered.
+// Queries cut short by their context are ignored since the database may never
+// have been asked.
+func (b *Breaker) Record(err error) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	if Classify(err) != ClassConnection {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+}
+
+// Open reports if the circuit is open. Once the cooldown passes the circuit is
+// half open and no longer reported as open, so the next query can be let
+// through as the trial that decides if it closes.
+func (b *Breaker) Open() bool {
+	if b == nil {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return false
+	}
+	return b.probing || time.Since(b.openedAt) < b.cooldown
+}
+
+// =============================================================================
+
+// Beginner is implemented by the handles that can start a transaction, both
+// *sqlx.DB and *DB.
+type Beginner interface {
+	BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error)
+}
+
+// WithinTran runs the function inside a transaction. The transaction is
+// committed if the function returns nil and rolled back otherwise. When the
+// transaction fails with a serialization failure or deadlock, the whole
+// transaction is run again a bounded number of times, so the function must
+// not have side effects outside of the transaction.
+func WithinTran(ctx context.Context, log *zap.SugaredLogger, db Beginner, fn func(tx sqlx.ExtContext) error) error {
+	var breaker *Breaker
+	if rdb, ok := db.(*DB); ok {
+		breaker = rdb.breaker
+	}
+
+	f := func() error {
+		tx, err := db.BeginTxx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("begin transaction: %w", err)
+		}
+
+		if err := fn(tx); err != nil {
+			if rerr := tx.Rollback(); rerr != nil && !errors.Is(rerr, sql.ErrTxDone) {
+				log.Errorw("database.WithinTran", "traceid", web.GetTraceID(ctx), "ERROR", rerr)
+			}
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("commit transaction: %w", err)
+		}
+
+		return nil
+	}
+
+	retryable := func(err error) bool {
+		switch Classify(err) {
+		case ClassSerialization, ClassDeadlock:
+			return true
+		}
+		return false
+	}
+
+	return retry(ctx, log, breaker, retryable, f)
+}
+
+// retry runs the operation through the breaker and runs it again while it
+// fails with a retryable error, up to maxAttempts times with a jittered
+// exponential backoff in between.
+func retry(ctx context.Context, log *zap.SugaredLogger, breaker *Breaker, retryable func(err error) bool, op func() error) error {
+	for attempt := 1; ; attempt++ {
+		if err := breaker.Allow(); err != nil {
+			return err
+		}
+
+		err := op()
+		breaker.Record(err)
+
+		if err == nil || attempt >= maxAttempts || ctx.Err() != nil || !retryable(err) {
+			return err
+		}
+
+		wait := retryWait << (attempt - 1)
+		wait = wait/2 + time.Duration(rand.Int63n(int64(wait)))
+
+		log.Infow("database retry", "traceid", web.GetTraceID(ctx), "attempt", attempt, "wait", wait, "ERROR", err)
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
+
+// execRetryable reports if a failed statement can be run again. Outside of a
+// transaction a statement that failed with a serialization failure or
+// deadlock was rolled back, so it is safe to run again. Connection errors are
+// not retried since the statement may have been applied.
+func execRetryable(db sqlx.ExtContext) func(err error) bool {
+	return func(err error) bool {
+		if _, inTx := db.(*sqlx.Tx); inTx {
+			return false
+		}
+
+		switch Classify(err) {
+		case ClassSerialization, ClassDeadlock:
+			return true
+		}
+		return false
+	}
+}
+
+// queryRetryable reports if a failed read can be run again. Reads have no
+// side effects so connection errors are retried as well, but inside a
+// transaction the error has aborted the transaction and only the caller can
+// start over.
+func queryRetryable(db sqlx.ExtContext) func(err error) bool {
+	return func(err error) bool {
+		if _, inTx := db.(*sqlx.Tx); inTx {
+			return false
+		}
+
+		switch Classify(err) {
+		case ClassConnection, ClassSerialization, ClassDeadlock:
+			return true
+		}
+		return false
+	}
+}
+
+// breakerFor returns the breaker of the handle, nil when it has none.
+func breakerFor(db sqlx.ExtContext) *Breaker {
+	if rdb, ok := db.(*DB); ok {
+		return rdb.breaker
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/piyush-saurabh/go-service/business/sys/database"
+	"go.uber.org/zap"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestBreaker(t *testing.T) {
+	t.Log("Given the need to stop sending queries to a database that is down.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen classifying errors.", testID)
+		{
+			tt := []struct {
+				err   error
+				class database.Class
+			}{
+				{&pq.Error{Code: "40001"}, database.ClassSerialization},
+				{&pq.Error{Code: "40P01"}, database.ClassDeadlock},
+				{&pq.Error{Code: "08006"}, database.ClassConnection},
+				{&pq.Error{Code: "23505"}, database.ClassOther},
+				{driver.ErrBadConn, database.ClassConnection},
+				{database.ErrNotFound, database.ClassOther},
+				{context.DeadlineExceeded, database.ClassOther},
+				{fmt.Errorf("query: %w", context.Canceled), database.ClassOther},
+			}
+			for _, tc := range tt {
+				if got := database.Classify(tc.err); got != tc.class {
+					t.Fatalf("\t%s\tTest %d:\tShould classify %v as %d : got %d.", failed, testID, tc.err, tc.class, got)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould classify the errors.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the database keeps failing to connect.", testID)
+		{
+			b := database.NewBreaker(2, 20*time.Millisecond)
+			connErr := &pq.Error{Code: "08006"}
+
+			b.Record(connErr)
+			if err := b.Allow(); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould stay closed below the threshold : %v.", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould stay closed below the threshold.", success, testID)
+
+			b.Record(connErr)
+			if err := b.Allow(); !errors.Is(err, database.ErrCircuitOpen) {
+				t.Fatalf("\t%s\tTest %d:\tShould open at the threshold : %v.", failed, testID, err)
+			}
+			if !b.Open() {
+				t.Fatalf("\t%s\tTest %d:\tShould report the circuit open.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould open at the threshold.", success, testID)
+
+			time.Sleep(30 * time.Millisecond)
+			if b.Open() {
+				t.Fatalf("\t%s\tTest %d:\tShould not report the circuit open once it is half open.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not report the circuit open once it is half open.", success, testID)
+
+			if err := b.Allow(); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould let a probe through after the cooldown : %v.", failed, testID, err)
+			}
+			if err := b.Allow(); !errors.Is(err, database.ErrCircuitOpen) {
+				t.Fatalf("\t%s\tTest %d:\tShould only let one probe through : %v.", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould let a single probe through after the cooldown.", success, testID)
+
+			b.Record(nil)
+			if b.Open() {
+				t.Fatalf("\t%s\tTest %d:\tShould close after a successful probe.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould close after a successful probe.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen queries run out of time.", testID)
+		{
+			b := database.NewBreaker(2, time.Minute)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+			defer cancel()
+			<-ctx.Done()
+
+			for i := 0; i < 3; i++ {
+				b.Record(fmt.Errorf("query: %w", ctx.Err()))
+			}
+			if err := b.Allow(); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not open on deadlines : %v.", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not open on deadlines.", success, testID)
+		}
+	}
+}
+
+// lostReply is a database handle whose statements are applied, but whose
+// connection drops before the reply comes back.
+type lostReply struct {
+	sqlx.ExtContext
+	applied int
+}
+
+func (db *lostReply) DriverName() string {
+	return "postgres"
+}
+
+func (db *lostReply) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	db.applied++
+	return nil, driver.ErrBadConn
+}
+
+func TestNamedExecRows(t *testing.T) {
+	t.Log("Given the need to not apply a write twice.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the connection drops after an update was committed.", testID)
+		{
+			db := lostReply{}
+			data := struct {
+				UserID  string `db:"user_id"`
+				Version int    `db:"version"`
+			}{"45b5fbd3-755f-4379-8f07-a58d4a30fa2f", 1}
+
+			const q = `UPDATE users SET version = version + 1 WHERE user_id = :user_id AND version = :version`
+			_, err := database.NamedExecRows(context.Background(), zap.NewNop().Sugar(), &db, q, data)
+
+			if database.Classify(err) != database.ClassConnection {
+				t.Fatalf("\t%s\tTest %d:\tShould return the connection error : %v.", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould return the connection error.", success, testID)
+
+			if db.applied != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould send the update once : sent %d times.", failed, testID, db.applied)
+			}
+			t.Logf("\t%s\tTest %d:\tShould send the update once.", success, testID)
+		}
+	}
+}
+
+func TestWithAdvisoryLock(t *testing.T) {
+	t.Log("Given the need to run a function while holding an advisory lock.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the pool allows a single connection.", testID)
+		{
+			db, err := sqlx.Open("postgres", "host=localhost")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to open the database: %v", failed, testID, err)
+			}
+			defer db.Close()
+			db.SetMaxOpenConns(1)
+
+			var called bool
+			f := func() error {
+				called = true
+				return nil
+			}
+
+			if err := database.WithAdvisoryLock(context.Background(), db, 1, f); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse to take the lock.", failed, testID)
+			}
+			if called {
+				t.Fatalf("\t%s\tTest %d:\tShould not run the function.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse to take the lock.", success, testID)
+		}
+	}
+}
@@ -23,6 +23,8 @@ type metrics struct {
 	requests   *expvar.Int
 	errors     *expvar.Int
 	panics     *expvar.Int
+	timeouts   *expvar.Int
+	shed       *expvar.Int
 }
 
 // init constructs the metrics value that will be used to capture metrics.
@@ -35,6 +37,8 @@ func init() {
 		requests:   expvar.NewInt("requests"),
 		errors:     expvar.NewInt("errors"),
 		panics:     expvar.NewInt("panics"),
+		timeouts:   expvar.NewInt("timeouts"),
+		shed:       expvar.NewInt("shed"),
 	}
 }
 
@@ -88,3 +92,17 @@ func AddPanics(ctx context.Context) {
 		v.panics.Add(1)
 	}
 }
+
+// AddTimeouts increments the timed out requests metric by 1.
+func AddTimeouts(ctx context.Context) {
+	if v, ok := ctx.Value(key).(*metrics); ok {
+		v.timeouts.Add(1)
+	}
+}
+
+// AddShed increments the metric of requests turned away under load by 1.
+func AddShed(ctx context.Context) {
+	if v, ok := ctx.Value(key).(*metrics); ok {
+		v.shed.Add(1)
+	}
+}
@@ -0,0 +1,128 @@
+// Package ratelimit provides token bucket rate limiting with pluggable
+// storage for the buckets.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit defines a token bucket. Requests take a token from the bucket, which
+// holds up to Burst tokens and is refilled at Rate tokens per second.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Enabled reports if the limit allows any requests to be limited. A limit
+// without a rate or burst is treated as no limit.
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	Allowed    bool          // a token was taken
+	Limit      int           // the size of the bucket
+	Remaining  int           // tokens left in the bucket
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until a token is available when not allowed
+}
+
+// Store declares the behavior for keeping token buckets. The in-memory store
+// limits each instance of the service on its own, a store on a shared backend
+// limits across all instances.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// =============================================================================
+
+// sweepEvery is how often the memory store drops buckets that are full.
+const sweepEvery = time.Minute
+
+// Memory keeps token buckets in memory.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// bucket is the state of a token bucket when it was last taken from.
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+// NewMemory constructs a store keeping token buckets in memory.
+func NewMemory() *Memory {
+	return &Memory{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Take takes a token from the bucket for the key.
+func (m *Memory) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep(now)
+
+	b, exists := m.buckets[key]
+	if !exists {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		m.buckets[key] = b
+	}
+	b.refill(now, limit)
+
+	res := Result{
+		Limit: limit.Burst,
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / limit.Rate)
+	}
+	res.Remaining = int(math.Floor(b.tokens))
+	res.Reset = seconds((float64(limit.Burst) - b.tokens) / limit.Rate)
+
+	return res, nil
+}
+
+// sweep drops the buckets that refilled since they were last taken from, a
+// new bucket is full as well so nothing is lost.
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepEvery {
+		return
+	}
+	m.lastSweep = now
+
+	for key, b := range m.buckets {
+		b.refill(now, b.limit)
+		if b.tokens >= float64(b.limit.Burst) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// refill adds the tokens earned since the bucket was last taken from.
+func (b *bucket) refill(now time.Time, limit Limit) {
+	b.tokens += now.Sub(b.last).Seconds() * limit.Rate
+	if max := float64(limit.Burst); b.tokens > max {
+		b.tokens = max
+	}
+	b.last = now
+	b.limit = limit
+}
+
+// seconds converts a number of seconds to a duration.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
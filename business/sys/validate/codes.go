@@ -0,0 +1,160 @@
+package validate
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Code is a stable, machine readable identifier for an error. Messages may
+// change over time, codes don't, so clients should branch on the code.
+type Code string
+
+// Set of error codes returned by the API.
+const (
+	CodeBadRequest           Code = "BAD_REQUEST"
+	CodeValidationFailed     Code = "VALIDATION_FAILED"
+	CodeInvalidJSON          Code = "INVALID_JSON"
+	CodeInvalidID            Code = "INVALID_ID"
+	CodeInvalidPatch         Code = "INVALID_PATCH"
+	CodeUnauthenticated      Code = "UNAUTHENTICATED"
+	CodeAuthenticationFailed Code = "AUTHENTICATION_FAILED"
+	CodeTokenInvalid         Code = "TOKEN_INVALID"
+	CodeTokenExpired         Code = "TOKEN_EXPIRED"
+	CodeForbidden            Code = "FORBIDDEN"
+	CodeNotFound             Code = "NOT_FOUND"
+	CodeUserNotFound         Code = "USER_NOT_FOUND"
+	CodeConflict             Code = "CONFLICT"
+	CodeVersionConflict      Code = "VERSION_CONFLICT"
+	CodePatchTestFailed      Code = "PATCH_TEST_FAILED"
+	CodeDuplicateValue       Code = "DUPLICATE_VALUE"
+	CodeDuplicateEmail       Code = "DUPLICATE_EMAIL"
+	CodePreconditionFailed   Code = "PRECONDITION_FAILED"
+	CodeBodyTooLarge         Code = "BODY_TOO_LARGE"
+	CodeUnsupportedMedia     Code = "UNSUPPORTED_MEDIA_TYPE"
+	CodeNotAcceptable        Code = "NOT_ACCEPTABLE"
+	CodeUnprocessable        Code = "UNPROCESSABLE"
+	CodeRateLimited          Code = "RATE_LIMITED"
+	CodeInvalidReference     Code = "INVALID_REFERENCE"
+	CodeValueOutOfRange      Code = "VALUE_OUT_OF_RANGE"
+	CodeMissingValue         Code = "MISSING_VALUE"
+	CodeInternal             Code = "INTERNAL"
+	CodeUnavailable          Code = "SERVICE_UNAVAILABLE"
+	CodeTimeout              Code = "REQUEST_TIMEOUT"
+	CodeOverloaded           Code = "OVERLOADED"
+)
+
+// CodeInfo documents an error code.
+type CodeInfo struct {
+	Code        Code
+	Status      int
+	Description string
+}
+
+// codes is the registry of every code the API returns, in the order they are
+// documented. Add new codes here so they show up in the generated listing.
+var codes = []CodeInfo{
+	{CodeBadRequest, http.StatusBadRequest, "The request is malformed."},
+	{CodeValidationFailed, http.StatusBadRequest, "One or more fields failed validation, see the field errors."},
+	{CodeInvalidJSON, http.StatusBadRequest, "The body is not a valid JSON document for the request, see the field errors."},
+	{CodeInvalidID, http.StatusBadRequest, "An ID is not in its proper form."},
+	{CodeInvalidPatch, http.StatusBadRequest, "The patch document can't be applied."},
+	{CodeUnauthenticated, http.StatusUnauthorized, "The request is missing valid credentials."},
+	{CodeAuthenticationFailed, http.StatusUnauthorized, "The email and password don't match."},
+	{CodeTokenInvalid, http.StatusUnauthorized, "The bearer token is malformed or not signed by us."},
+	{CodeTokenExpired, http.StatusUnauthorized, "The bearer token has expired, request a new one."},
+	{CodeForbidden, http.StatusForbidden, "The caller is not allowed to take the action."},
+	{CodeNotFound, http.StatusNotFound, "The resource does not exist."},
+	{CodeUserNotFound, http.StatusNotFound, "The user does not exist."},
+	{CodeNotAcceptable, http.StatusNotAcceptable, "None of the types in the Accept header can be produced for the response."},
+	{CodeConflict, http.StatusConflict, "The request conflicts with the current state of the resource."},
+	{CodeVersionConflict, http.StatusConflict, "The resource was modified since it was read, 412 when If-Match was sent."},
+	{CodePatchTestFailed, http.StatusConflict, "A test operation in the JSON Patch did not match."},
+	{CodeDuplicateValue, http.StatusConflict, "A value that must be unique is already in use."},
+	{CodeDuplicateEmail, http.StatusConflict, "The email is already in use by another user."},
+	{CodePreconditionFailed, http.StatusPreconditionFailed, "A precondition header like If-Match is invalid."},
+	{CodeBodyTooLarge, http.StatusRequestEntityTooLarge, "The body is larger than the route accepts."},
+	{CodeUnsupportedMedia, http.StatusUnsupportedMediaType, "The Content-Type of the request is not supported."},
+	{CodeUnprocessable, http.StatusUnprocessableEntity, "The data is well formed but can't be stored."},
+	{CodeInvalidReference, http.StatusUnprocessableEntity, "A value refers to a record that does not exist."},
+	{CodeValueOutOfRange, http.StatusUnprocessableEntity, "A value is not allowed by the schema."},
+	{CodeMissingValue, http.StatusUnprocessableEntity, "A required value is missing."},
+	{CodeRateLimited, http.StatusTooManyRequests, "Too many requests were made, try again after Retry-After seconds."},
+	{CodeInternal, http.StatusInternalServerError, "An unexpected error occurred."},
+	{CodeUnavailable, http.StatusServiceUnavailable, "The service is temporarily unavailable, try again later."},
+	{CodeTimeout, http.StatusServiceUnavailable, "The request took longer than the route allows, try again later."},
+	{CodeOverloaded, http.StatusServiceUnavailable, "The service has too many requests in flight, try again after Retry-After seconds."},
+}
+
+// Codes returns the registered error codes in the order they are documented.
+func Codes() []CodeInfo {
+	cs := make([]CodeInfo, len(codes))
+	copy(cs, codes)
+	return cs
+}
+
+// statusCodes provides the code used for a status when the error doesn't
+// carry one of its own.
+var statusCodes = map[int]Code{
+	http.StatusBadRequest:            CodeBadRequest,
+	http.StatusUnauthorized:          CodeUnauthenticated,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusNotAcceptable:         CodeNotAcceptable,
+	http.StatusConflict:              CodeConflict,
+	http.StatusPreconditionFailed:    CodePreconditionFailed,
+	http.StatusRequestEntityTooLarge: CodeBodyTooLarge,
+	http.StatusUnsupportedMediaType:  CodeUnsupportedMedia,
+	http.StatusUnprocessableEntity:   CodeUnprocessable,
+	http.StatusTooManyRequests:       CodeRateLimited,
+	http.StatusInternalServerError:   CodeInternal,
+	http.StatusServiceUnavailable:    CodeUnavailable,
+}
+
+// =============================================================================
+
+// codedError is an error value that carries a code.
+type codedError struct {
+	code Code
+	msg  string
+}
+
+// NewError returns an error with the message that carries the code. It is
+// used to declare sentinel errors that map to a code wherever they surface.
+func NewError(code Code, msg string) error {
+	return &codedError{code: code, msg: msg}
+}
+
+// Error implements the error interface.
+func (err *codedError) Error() string {
+	return err.msg
+}
+
+// Code returns the code of the error.
+func (err *codedError) Code() Code {
+	return err.code
+}
+
+// CodeOf returns the code of the first error in the chain that carries one,
+// or an empty code if none of them do.
+func CodeOf(err error) Code {
+	var coder interface{ Code() Code }
+	if errors.As(err, &coder) {
+		return coder.Code()
+	}
+	return ""
+}
+
+// CodeFor returns the code of the error, falling back to the code for the
+// status when the error doesn't carry one.
+func CodeFor(err error, status int) Code {
+	if code := CodeOf(err); code != "" {
+		return code
+	}
+	if code, exists := statusCodes[status]; exists {
+		return code
+	}
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
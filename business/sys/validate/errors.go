@@ -6,26 +6,51 @@ import (
 )
 
 // ErrInvalidID occurs when an ID is not in a valid form.
-var ErrInvalidID = errors.New("ID is not in its proper form")
+var ErrInvalidID = NewError(CodeInvalidID, "ID is not in its proper form")
 
 // ErrorResponse is the form used for API responses from failures in the API.
 type ErrorResponse struct {
 	Error  string `json:"error"`
+	Code   Code   `json:"code"`
 	Fields string `json:"fields,omitempty"`
 }
 
+// ContentTypeProblem is the media type of Problem responses.
+const ContentTypeProblem = "application/problem+json"
+
+// Problem is the RFC 7807 form used for API responses from failures when the
+// client accepts application/problem+json.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     Code         `json:"code"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
 // RequestError is used to pass an error during the request through the
 // application with web specific context.
 type RequestError struct {
 	Err    error
 	Status int
 	Fields error
+	Code   Code
 }
 
 // NewRequestError wraps a provided error with an HTTP status code. This
-// function should be used when handlers encounter expected errors.
+// function should be used when handlers encounter expected errors. The code
+// is taken from the error, or from the status if the error has none.
 func NewRequestError(err error, status int) error {
-	return &RequestError{err, status, nil}
+	return &RequestError{err, status, nil, CodeFor(err, status)}
+}
+
+// NewCodedRequestError wraps a provided error with an HTTP status code and
+// the code to return, for when the handler knows more about the failure than
+// the error does.
+func NewCodedRequestError(err error, status int, code Code) error {
+	return &RequestError{err, status, nil, code}
 }
 
 // Error implements the error interface. It uses the default message of the
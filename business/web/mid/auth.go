@@ -34,7 +34,7 @@ func Authenticate(a *auth.Auth) web.Middleware {
 			}
 
 			// Validate the token is signed by us.
-			claims, err := a.ValidateToken(parts[1])
+			claims, err := a.ValidateToken(ctx, parts[1])
 			if err != nil {
 				return validate.NewRequestError(err, http.StatusUnauthorized)
 			}
@@ -43,6 +43,9 @@ func Authenticate(a *auth.Auth) web.Middleware {
 			// [PS] Claims are set in the context. It might be used in the business layer later
 			ctx = auth.SetClaims(ctx, claims)
 
+			// Let the access log know who made the request.
+			setSubject(ctx, claims.Subject)
+
 			// Call the next handler.
 			return handler(ctx, w, r)
 		}
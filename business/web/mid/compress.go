@@ -0,0 +1,344 @@
+package mid
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/piyush-saurabh/go-service/business/sys/validate"
+	"github.com/piyush-saurabh/go-service/foundation/web"
+)
+
+// CompressConfig defines how responses are compressed.
+type CompressConfig struct {
+
+	// MinSize is the smallest body in bytes worth compressing. Smaller bodies
+	// are sent as they are. A value of 0 uses 1024 bytes.
+	MinSize int
+
+	// Level is the gzip and deflate compression level, from 1 for the
+	// fastest to 9 for the smallest. A value of 0 uses the default level.
+	Level int
+}
+
+// Set of content encodings supported for requests and responses. Brotli and
+// zstd are not in the standard library so they aren't offered.
+const (
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+)
+
+// Compress compresses responses with gzip or deflate when the client accepts
+// it through Accept-Encoding, and decompresses request bodies sent with a
+// gzip or deflate Content-Encoding before handlers read them. Small bodies
+// and content types that are already compressed are sent as they are.
+func Compress(cfg CompressConfig) web.Middleware {
+	if cfg.MinSize <= 0 {
+		cfg.MinSize = 1024
+	}
+	if cfg.Level == 0 || cfg.Level < gzip.HuffmanOnly || cfg.Level > gzip.BestCompression {
+		cfg.Level = gzip.DefaultCompression
+	}
+
+	// Compressors are expensive to allocate so they are reused across
+	// requests.
+	pools := map[string]*sync.Pool{
+		encodingGzip: {New: func() interface{} {
+			zw, _ := gzip.NewWriterLevel(nil, cfg.Level)
+			return zw
+		}},
+		encodingDeflate: {New: func() interface{} {
+			zw, _ := flate.NewWriter(nil, cfg.Level)
+			return zw
+		}},
+	}
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			if err := decompressBody(r); err != nil {
+				return err
+			}
+
+			// The response depends on Accept-Encoding whether it ends up
+			// compressed or not, so caches must key on it.
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := acceptEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				return handler(ctx, w, r)
+			}
+
+			cw := compressWriter{
+				ResponseWriter: w,
+				encoding:       encoding,
+				pool:           pools[encoding],
+				minSize:        cfg.MinSize,
+			}
+			defer cw.close()
+
+			return handler(ctx, &cw, r)
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// decompressBody replaces a compressed request body with a reader that
+// decompresses it, so the body reads as if it was sent uncompressed.
+func decompressBody(r *http.Request) error {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+
+	var fn func(body io.ReadCloser) (io.ReadCloser, error)
+	switch encoding {
+	case "", "identity":
+		return nil
+
+	case encodingGzip, "x-gzip":
+		fn = func(body io.ReadCloser) (io.ReadCloser, error) {
+			zr, err := gzip.NewReader(body)
+			if err != nil {
+				return nil, err
+			}
+			return readCloser{zr, body}, nil
+		}
+
+	case encodingDeflate:
+		fn = func(body io.ReadCloser) (io.ReadCloser, error) {
+			return readCloser{flate.NewReader(body), body}, nil
+		}
+
+	default:
+		err := fmt.Errorf("unsupported content encoding [%s]", encoding)
+		return validate.NewRequestError(err, http.StatusUnsupportedMediaType)
+	}
+
+	if err := web.WrapBody(r, fn); err != nil {
+		err = fmt.Errorf("decompressing body: %w", err)
+		return validate.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	r.ContentLength = -1
+
+	return nil
+}
+
+// readCloser reads from a decompressing reader and closes the body it reads
+// from.
+type readCloser struct {
+	io.Reader
+	body io.Closer
+}
+
+// Close closes the compressed body.
+func (rc readCloser) Close() error {
+	return rc.body.Close()
+}
+
+// acceptEncoding returns the supported encoding the client prefers, or an
+// empty string when the response must not be compressed.
+func acceptEncoding(header string) string {
+	var best string
+	var bestQ float64
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				v, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					v = 0
+				}
+				q = v
+			}
+		}
+
+		switch coding {
+		case encodingGzip, encodingDeflate:
+		case "*":
+			coding = encodingGzip
+		default:
+			continue
+		}
+
+		// Ties go to the encoding listed first.
+		if q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+
+	return best
+}
+
+// compressed reports if the content type is already compressed, in which case
+// compressing it again only costs time.
+func compressed(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case mediaType == "image/svg+xml":
+		return false
+	case strings.HasPrefix(mediaType, "image/"),
+		strings.HasPrefix(mediaType, "video/"),
+		strings.HasPrefix(mediaType, "audio/"):
+		return true
+	}
+
+	switch mediaType {
+	case "application/gzip", "application/x-gzip", "application/zip",
+		"application/x-bzip2", "application/x-7z-compressed", "application/zstd",
+		"font/woff", "font/woff2":
+		return true
+	}
+
+	return false
+}
+
+// =============================================================================
+
+// compressWriter holds back the start of the response until it knows if the
+// body is worth compressing, which is once MinSize bytes were written, the
+// handler flushes or the handler is done.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding   string
+	pool       *sync.Pool
+	minSize    int
+	statusCode int
+	buf        []byte
+	decided    bool
+	zw         compressor
+}
+
+// compressor is the behavior shared by the gzip and deflate writers.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// WriteHeader holds the status code back until the response is started.
+// Responses without a body are started right away.
+func (cw *compressWriter) WriteHeader(statusCode int) {
+	if cw.decided || cw.statusCode != 0 {
+		return
+	}
+	cw.statusCode = statusCode
+
+	if statusCode == http.StatusNoContent || statusCode == http.StatusNotModified || statusCode < http.StatusOK {
+		cw.start(false)
+	}
+}
+
+// Write buffers the body until MinSize bytes were written.
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) < cw.minSize {
+			return len(b), nil
+		}
+		if err := cw.start(cw.compressible()); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	if cw.zw != nil {
+		return cw.zw.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush starts the response and sends what was written so far. A handler
+// flushing is streaming, so the body is compressed whatever its size.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.start(cw.compressible())
+	}
+
+	if cw.zw != nil {
+		cw.zw.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer for use by http.ResponseController.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// compressible reports if the response can be compressed based on the
+// headers set by the handler.
+func (cw *compressWriter) compressible() bool {
+	h := cw.Header()
+	return h.Get("Content-Encoding") == "" && !compressed(h.Get("Content-Type"))
+}
+
+// start sends the status code and the buffered body, compressed or not.
+func (cw *compressWriter) start(compress bool) error {
+	cw.decided = true
+
+	if compress {
+		h := cw.Header()
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+
+		cw.zw = cw.pool.Get().(compressor)
+		cw.zw.Reset(cw.ResponseWriter)
+	}
+
+	if cw.statusCode != 0 {
+		cw.ResponseWriter.WriteHeader(cw.statusCode)
+	}
+
+	if len(cw.buf) == 0 {
+		return nil
+	}
+
+	buf := cw.buf
+	cw.buf = nil
+	if cw.zw != nil {
+		_, err := cw.zw.Write(buf)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+// close sends a response that was too small to compress, or finishes the
+// compressed body.
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		if cw.statusCode == 0 && len(cw.buf) == 0 {
+			return
+		}
+		cw.start(false)
+		return
+	}
+
+	if cw.zw != nil {
+		cw.zw.Close()
+		cw.pool.Put(cw.zw)
+	}
+}
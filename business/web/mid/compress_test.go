@@ -0,0 +1,113 @@
+package mid_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/piyush-saurabh/go-service/business/web/mid"
+	"github.com/piyush-saurabh/go-service/foundation/web"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat("gophers ", 200)
+
+	tt := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		body           string
+		encoding       string
+	}{
+		{"a large body", "gzip, deflate", "application/json", large, "gzip"},
+		{"a preferred encoding", "gzip;q=0.5, deflate", "application/json", large, "deflate"},
+		{"a small body", "gzip", "application/json", "gophers", ""},
+		{"an image", "gzip", "image/png", large, ""},
+		{"no accepted encoding", "br", "application/json", large, ""},
+	}
+
+	t.Log("Given the need to compress responses.")
+	{
+		for testID, tc := range tt {
+			t.Logf("\tTest %d:\tWhen sending %s.", testID, tc.name)
+			{
+				h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+					w.Header().Set("Content-Type", tc.contentType)
+					w.WriteHeader(http.StatusOK)
+					io.WriteString(w, tc.body)
+					return nil
+				}
+				app := web.NewApp(nil, mid.Compress(mid.CompressConfig{MinSize: 64}))
+				app.Handle(http.MethodGet, "", "/", h)
+
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.Header.Set("Accept-Encoding", tc.acceptEncoding)
+				w := httptest.NewRecorder()
+				app.ServeHTTP(w, r)
+
+				if got := w.Header().Get("Content-Encoding"); got != tc.encoding {
+					t.Fatalf("\t%s\tTest %d:\tShould use the %q encoding : got %q.", failed, testID, tc.encoding, got)
+				}
+				t.Logf("\t%s\tTest %d:\tShould use the %q encoding.", success, testID, tc.encoding)
+
+				if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+					t.Fatalf("\t%s\tTest %d:\tShould vary on Accept-Encoding : got %q.", failed, testID, got)
+				}
+				t.Logf("\t%s\tTest %d:\tShould vary on Accept-Encoding.", success, testID)
+
+				if tc.encoding == "gzip" {
+					zr, err := gzip.NewReader(w.Body)
+					if err != nil {
+						t.Fatalf("\t%s\tTest %d:\tShould be able to read the gzip body : %v.", failed, testID, err)
+					}
+					b, err := io.ReadAll(zr)
+					if err != nil || string(b) != tc.body {
+						t.Fatalf("\t%s\tTest %d:\tShould get the body back : %v.", failed, testID, err)
+					}
+					t.Logf("\t%s\tTest %d:\tShould get the body back.", success, testID)
+				}
+			}
+		}
+
+		testID := len(tt)
+		t.Logf("\tTest %d:\tWhen receiving a gzip request body.", testID)
+		{
+			var got string
+			h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+				b, err := io.ReadAll(r.Body)
+				if err != nil {
+					return err
+				}
+				got = string(b)
+				return nil
+			}
+			app := web.NewApp(nil, mid.Compress(mid.CompressConfig{}))
+			app.Handle(http.MethodPost, "", "/", h)
+
+			var body bytes.Buffer
+			zw := gzip.NewWriter(&body)
+			io.WriteString(zw, large)
+			zw.Close()
+
+			r := httptest.NewRequest(http.MethodPost, "/", &body)
+			r.Header.Set("Content-Encoding", "gzip")
+			app.ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != large {
+				t.Fatalf("\t%s\tTest %d:\tShould read the decompressed body : got %d bytes.", failed, testID, len(got))
+			}
+			t.Logf("\t%s\tTest %d:\tShould read the decompressed body.", success, testID)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package mid
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/piyush-saurabh/go-service/foundation/web"
+)
+
+// CORSConfig defines which cross-origin requests browsers are allowed to make.
+type CORSConfig struct {
+
+	// AllowedOrigins is the set of origins allowed to make requests, like
+	// https://example.com. A "*" allows any origin and a "*." prefix on the
+	// host allows any subdomain, like https://*.example.com. An empty set
+	// disables CORS.
+	AllowedOrigins []string
+
+	// AllowedMethods is the set of methods allowed in preflight requests.
+	AllowedMethods []string
+
+	// AllowedHeaders is the set of request headers allowed in preflight
+	// requests.
+	AllowedHeaders []string
+
+	// ExposedHeaders is the set of response headers browsers let scripts read.
+	ExposedHeaders []string
+
+	// AllowCredentials allows requests to include cookies and the
+	// Authorization header. The origin is echoed back instead of "*". It
+	// can't be combined with allowing any origin.
+	AllowCredentials bool
+
+	// MaxAge is how long browsers can cache the answer to a preflight
+	// request. A value of 0 leaves it to the browser.
+	MaxAge time.Duration
+}
+
+// Validate reports configurations browsers would be wrong to trust. Allowing
+// credentials from any origin lets every site make requests on behalf of
+// the user, which is why the CORS spec forbids "*" with credentials.
+func (cfg CORSConfig) Validate() error {
+	if cfg.AllowCredentials && allowAny(cfg.AllowedOrigins) {
+		return errors.New("cors: credentials can't be allowed for any origin")
+	}
+	return nil
+}
+
+// CORS sets the CORS headers on responses to requests from allowed origins.
+// Preflight requests are answered by the OPTIONS route registered for every
+// path, so this middleware must run for OPTIONS requests as well. It can be
+// used on a route to replace the configuration of the application, the
+// innermost CORS middleware decides. Credentials are never allowed for any
+// origin, use Validate to reject such a configuration up front.
+func CORS(cfg CORSConfig) web.Middleware {
+	allowAll := allowAny(cfg.AllowedOrigins)
+
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge / time.Second))
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			origin := r.Header.Get("Origin")
+			if len(cfg.AllowedOrigins) == 0 || origin == "" {
+				return handler(ctx, w, r)
+			}
+
+			// The response depends on the origin of the request, so caches
+			// must key on it.
+			h := w.Header()
+			if !varies(h, "Origin") {
+				h.Add("Vary", "Origin")
+			}
+
+			// Headers set by an outer CORS middleware are removed so the
+			// configuration of the route decides.
+			for k := range h {
+				if strings.HasPrefix(k, "Access-Control-") {
+					h.Del(k)
+				}
+			}
+
+			if !allowOrigin(cfg.AllowedOrigins, origin) {
+				return handler(ctx, w, r)
+			}
+
+			switch {
+			case allowAll:
+				h.Set("Access-Control-Allow-Origin", "*")
+			default:
+				h.Set("Access-Control-Allow-Origin", origin)
+				if cfg.AllowCredentials {
+					h.Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+			if exposed != "" {
+				h.Set("Access-Control-Expose-Headers", exposed)
+			}
+
+			// A preflight request asks which methods and headers the actual
+			// request can use.
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				if methods != "" {
+					h.Set("Access-Control-Allow-Methods", methods)
+				}
+				if headers != "" {
+					h.Set("Access-Control-Allow-Headers", headers)
+				}
+				if cfg.MaxAge > 0 {
+					h.Set("Access-Control-Max-Age", maxAge)
+				}
+			}
+
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// allowAny reports if the allowed origins include "*".
+func allowAny(allowed []string) bool {
+	for _, origin := range allowed {
+		if strings.TrimSpace(origin) == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// allowOrigin reports if the origin matches one of the allowed origins.
+func allowOrigin(allowed []string, origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+
+		switch {
+		case pattern == "*" || pattern == origin:
+			return true
+
+		case strings.Contains(pattern, "://*."):
+			i := strings.Index(pattern, "*")
+			prefix, suffix := pattern[:i], pattern[i+1:]
+
+			if len(origin) <= len(prefix)+len(suffix) ||
+				!strings.HasPrefix(origin, prefix) ||
+				!strings.HasSuffix(origin, suffix) {
+				continue
+			}
+
+			// The wildcard matches one or more host labels, never an empty
+			// one or anything outside of the host.
+			sub := origin[len(prefix) : len(origin)-len(suffix)]
+			if !strings.HasPrefix(sub, ".") && !strings.ContainsAny(sub, "/:@") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// varies reports if the Vary header already lists the header.
+func varies(h http.Header, header string) bool {
+	for _, v := range h.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), header) {
+				return true
+			}
+		}
+	}
+	return false
+}
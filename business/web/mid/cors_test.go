@@ -0,0 +1,129 @@
+package mid_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/piyush-saurabh/go-service/business/web/mid"
+	"github.com/piyush-saurabh/go-service/foundation/web"
+)
+
+func TestCORS(t *testing.T) {
+	cfg := mid.CORSConfig{
+		AllowedOrigins: []string{"https://example.com", "https://*.gophers.dev"},
+		AllowedMethods: []string{http.MethodGet, http.MethodPost},
+		AllowedHeaders: []string{"Authorization", "Content-Type"},
+		ExposedHeaders: []string{"ETag"},
+		MaxAge:         time.Hour,
+	}
+
+	tt := []struct {
+		name    string
+		method  string
+		origin  string
+		allowed string
+		methods string
+		maxAge  string
+	}{
+		{"an allowed origin", http.MethodGet, "https://example.com", "https://example.com", "", ""},
+		{"a subdomain", http.MethodGet, "https://api.gophers.dev", "https://api.gophers.dev", "", ""},
+		{"the bare domain", http.MethodGet, "https://gophers.dev", "", "", ""},
+		{"an unknown origin", http.MethodGet, "https://evil.com", "", "", ""},
+		{"a preflight request", http.MethodOptions, "https://example.com", "https://example.com", "GET, POST", "3600"},
+		{"a rejected preflight request", http.MethodOptions, "https://evil.com", "", "", ""},
+	}
+
+	t.Log("Given the need to allow cross-origin requests.")
+	{
+		for testID, tc := range tt {
+			t.Logf("\tTest %d:\tWhen receiving %s.", testID, tc.name)
+			{
+				h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+					return web.Respond(ctx, w, nil, http.StatusNoContent)
+				}
+				app := web.NewApp(nil, mid.CORS(cfg))
+				app.Handle(http.MethodGet, "", "/", h)
+
+				r := httptest.NewRequest(tc.method, "/", nil)
+				r.Header.Set("Origin", tc.origin)
+				if tc.method == http.MethodOptions {
+					r.Header.Set("Access-Control-Request-Method", http.MethodGet)
+				}
+				w := httptest.NewRecorder()
+				app.ServeHTTP(w, r)
+
+				if w.Code != http.StatusNoContent {
+					t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 204 : %d.", failed, testID, w.Code)
+				}
+				t.Logf("\t%s\tTest %d:\tShould receive a status code of 204.", success, testID)
+
+				if got := w.Header().Get("Access-Control-Allow-Origin"); got != tc.allowed {
+					t.Fatalf("\t%s\tTest %d:\tShould allow the origin %q : got %q.", failed, testID, tc.allowed, got)
+				}
+				t.Logf("\t%s\tTest %d:\tShould allow the origin %q.", success, testID, tc.allowed)
+
+				if got := w.Header().Get("Access-Control-Allow-Methods"); got != tc.methods {
+					t.Fatalf("\t%s\tTest %d:\tShould allow the methods %q : got %q.", failed, testID, tc.methods, got)
+				}
+				if got := w.Header().Get("Access-Control-Max-Age"); got != tc.maxAge {
+					t.Fatalf("\t%s\tTest %d:\tShould set a max age of %q : got %q.", failed, testID, tc.maxAge, got)
+				}
+				t.Logf("\t%s\tTest %d:\tShould answer the preflight request.", success, testID)
+
+				if got := w.Header().Get("Vary"); got != "Origin" {
+					t.Fatalf("\t%s\tTest %d:\tShould vary on Origin : got %q.", failed, testID, got)
+				}
+				t.Logf("\t%s\tTest %d:\tShould vary on Origin.", success, testID)
+			}
+		}
+
+		testID := len(tt)
+		t.Logf("\tTest %d:\tWhen a route has its own configuration.", testID)
+		{
+			h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+				return web.Respond(ctx, w, nil, http.StatusNoContent)
+			}
+			app := web.NewApp(nil, mid.CORS(cfg))
+			app.Handle(http.MethodGet, "", "/", h, mid.CORS(mid.CORSConfig{AllowedOrigins: []string{"https://admin.example.com"}}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Origin", "https://example.com")
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, r)
+
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould use the configuration of the route : got %q.", failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould use the configuration of the route.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen credentials are allowed for any origin.", testID)
+		{
+			cfg := mid.CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}
+			if err := cfg.Validate(); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould reject the configuration.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject the configuration.", success, testID)
+
+			h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+				return web.Respond(ctx, w, nil, http.StatusNoContent)
+			}
+			app := web.NewApp(nil, mid.CORS(cfg))
+			app.Handle(http.MethodGet, "", "/", h)
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Origin", "https://evil.com")
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, r)
+
+			if w.Header().Get("Access-Control-Allow-Origin") != "*" || w.Header().Get("Access-Control-Allow-Credentials") != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould not allow credentials : %v.", failed, testID, w.Header())
+			}
+			t.Logf("\t%s\tTest %d:\tShould not allow credentials.", success, testID)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package mid
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/piyush-saurabh/go-service/business/sys/auth"
+	"github.com/piyush-saurabh/go-service/foundation/logger"
+	"github.com/piyush-saurabh/go-service/foundation/web"
+	"go.uber.org/zap"
+)
+
+// debugHeader is the request header used to ask for debug logging.
+const debugHeader = "X-Debug-Log"
+
+// DebugLogging forces debug level logging for a single request when the
+// X-Debug-Log header is provided. Only callers presenting a token with the
+// ADMIN role can turn this on, otherwise the header is ignored.
+func DebugLogging(log *zap.SugaredLogger, a *auth.Auth, level *logger.Level) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			if r.Header.Get(debugHeader) == "" {
+				return handler(ctx, w, r)
+			}
+
+			v, err := web.GetValues(ctx)
+			if err != nil {
+				return web.NewShutdownError("web value missing from context")
+			}
+
+			// This runs ahead of Authenticate so the token has to be checked
+			// here to see who is asking.
+			parts := strings.Split(r.Header.Get("authorization"), " ")
+			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+				log.Infow("debug logging", "traceid", v.TraceID, "status", "ignored, no token")
+				return handler(ctx, w, r)
+			}
+
+			claims, err := a.ValidateToken(ctx, parts[1])
+			if err != nil || !claims.Authorized(auth.RoleAdmin) {
+				log.Infow("debug logging", "traceid", v.TraceID, "status", "ignored, not an admin")
+				return handler(ctx, w, r)
+			}
+
+			log.Infow("debug logging", "traceid", v.TraceID, "status", "enabled", "subject", claims.Subject)
+
+			level.EnableTrace(v.TraceID)
+			defer level.DisableTrace(v.TraceID)
+
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
@@ -2,10 +2,16 @@ package mid
 
 import (
 	"context"
+	"errors"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/piyush-saurabh/go-service/business/sys/database"
 	"github.com/piyush-saurabh/go-service/business/sys/validate"
 	"github.com/piyush-saurabh/go-service/foundation/web"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -37,35 +43,110 @@ func Errors(log *zap.SugaredLogger) web.Middleware {
 				// Log the error.
 				log.Errorw("ERROR", "traceid", v.TraceID, "ERROR", err)
 
+				// Record the error against the route span. The span status is
+				// set from the final status code once the response is written.
+				trace.SpanFromContext(ctx).RecordError(err)
+
+				// A stream that failed midway has already sent its status
+				// code, so there is no error response left to send. The
+				// connection is aborted so the client sees a broken transfer
+				// rather than a well formed but truncated body.
+				if errors.Is(err, web.ErrStreamAborted) {
+					panic(http.ErrAbortHandler)
+				}
+
 				// [PS] know the type of error we received
 				// Build out the error response.
-				var er validate.ErrorResponse
+				var message string
+				var fields validate.FieldErrors
 				var status int
+				var code validate.Code
 				switch act := validate.Cause(err).(type) {
 				case validate.FieldErrors:
-					er = validate.ErrorResponse{
-						Error:  "data validation error",
-						Fields: act.Error(),
+					message = "data validation error"
+					fields = act
+					status = http.StatusBadRequest
+					code = validate.CodeValidationFailed
+
+				case *web.DecodeError:
+					message = act.Error()
+					if act.Field != "" {
+						fields = validate.FieldErrors{{Field: act.Field, Error: act.Msg}}
 					}
 					status = http.StatusBadRequest
+					code = validate.CodeInvalidJSON
 
 				case *validate.RequestError:
-					er = validate.ErrorResponse{
-						Error: act.Error(),
-					}
+					message = act.Error()
+					errors.As(act.Fields, &fields)
 					status = act.Status
+					code = act.Code
+					if code == "" {
+						code = validate.CodeFor(act.Err, act.Status)
+					}
 
 				default:
-					// untrusted error. Return 500
-					er = validate.ErrorResponse{
-						Error: http.StatusText(http.StatusInternalServerError),
+					switch {
+
+					// The body was rejected before it was decoded.
+					case errors.Is(err, web.ErrBodyTooLarge):
+						message = web.ErrBodyTooLarge.Error()
+						status = http.StatusRequestEntityTooLarge
+						code = validate.CodeBodyTooLarge
+
+					case errors.Is(err, web.ErrUnsupportedMediaType):
+						message = web.ErrUnsupportedMediaType.Error()
+						status = http.StatusUnsupportedMediaType
+						code = validate.CodeUnsupportedMedia
+
+					// None of the types the client accepts can encode the
+					// response, the error itself is sent as JSON.
+					case errors.Is(err, web.ErrNotAcceptable):
+						message = web.ErrNotAcceptable.Error()
+						status = http.StatusNotAcceptable
+						code = validate.CodeNotAcceptable
+
+					// The database is known to be down, let the client know
+					// it's worth trying again later.
+					case errors.Is(err, database.ErrCircuitOpen):
+						message = http.StatusText(http.StatusServiceUnavailable)
+						status = http.StatusServiceUnavailable
+						code = validate.CodeUnavailable
+
+					default:
+						// untrusted error. Return 500
+						message = http.StatusText(http.StatusInternalServerError)
+						status = http.StatusInternalServerError
+						code = validate.CodeInternal
 					}
-					status = http.StatusInternalServerError
 				}
 
-				// Respond with the error back to the client.
-				if err := web.Respond(ctx, w, er, status); err != nil {
-					return err
+				// Clients asking for problem+json get an RFC 7807 document,
+				// everyone else keeps the original error response.
+				if acceptsProblem(r) {
+					pr := validate.Problem{
+						Type:     "about:blank",
+						Title:    http.StatusText(status),
+						Status:   status,
+						Detail:   message,
+						Instance: v.TraceID,
+						Code:     code,
+						Errors:   fields,
+					}
+					if err := web.RespondAs(ctx, w, pr, status, validate.ContentTypeProblem); err != nil {
+						return err
+					}
+				} else {
+					er := validate.ErrorResponse{
+						Error: message,
+						Code:  code,
+					}
+					if fields != nil {
+						er.Fields = fields.Error()
+					}
+					if err := web.RespondAs(ctx, w, er, status, web.ContentTypeJSON); err != nil {
+						return err
+					}
 				}
 
 				// If we receive the shutdown err we need to return it
@@ -83,3 +164,21 @@ func Errors(log *zap.SugaredLogger) web.Middleware {
 	}
 	return m // returns middleware
 }
+
+// acceptsProblem reports if the client listed application/problem+json in
+// its Accept header.
+func acceptsProblem(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil || mediaType != validate.ContentTypeProblem {
+				continue
+			}
+			if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+				continue
+			}
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package mid_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/piyush-saurabh/go-service/business/web/mid"
+	"github.com/piyush-saurabh/go-service/foundation/web"
+	"go.uber.org/zap"
+)
+
+func TestErrors(t *testing.T) {
+	t.Log("Given the need to report failures to the client.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a stream fails after the response was started.", testID)
+		{
+			stream := func(send func(v interface{}) error) error {
+				if err := send(struct{ N int }{1}); err != nil {
+					return err
+				}
+				return errors.New("query failed")
+			}
+			h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+				return web.RespondStream(ctx, w, http.StatusOK, stream)
+			}
+
+			log := zap.NewNop().Sugar()
+			app := web.NewApp(nil, mid.Logger(log, mid.LoggerConfig{}), mid.Errors(log))
+			app.Handle(http.MethodGet, "", "/", h)
+
+			srv := httptest.NewUnstartedServer(app)
+			srv.Config.ErrorLog = discardLog()
+			srv.Start()
+			defer srv.Close()
+
+			req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct a request : %v.", failed, testID, err)
+			}
+			req.Header.Set("Accept", web.ContentTypeNDJSON)
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to make the call : %v.", failed, testID, err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive the status code of the stream : %d.", failed, testID, resp.StatusCode)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive the status code of the stream.", success, testID)
+
+			if _, err := io.ReadAll(resp.Body); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould fail to read the truncated body.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould fail to read the truncated body.", success, testID)
+		}
+	}
+}
+
+// discardLog returns a logger for the test server that drops its output.
+func discardLog() *log.Logger {
+	return log.New(io.Discard, "", 0)
+}
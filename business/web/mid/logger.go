@@ -2,23 +2,70 @@ package mid
 
 import (
 	"context"
+	"fmt"
+	"math/rand"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/piyush-saurabh/go-service/foundation/web"
 	"go.uber.org/zap"
 )
 
-// Logger ...
-func Logger(log *zap.SugaredLogger) web.Middleware {
+// LoggerConfig defines how requests are written to the access log.
+type LoggerConfig struct {
+
+	// TrustedProxies is the set of networks allowed to report the client
+	// address through the X-Forwarded-For header.
+	TrustedProxies []*net.IPNet
+
+	// SampleEvery logs one in every N successful requests. Failed requests
+	// are always logged. A value of 0 or 1 logs every request.
+	SampleEvery int
+}
+
+// ParseTrustedProxies converts a list of IP addresses and CIDR ranges into
+// the set of networks used by LoggerConfig.
+func ParseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid proxy address %q", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy range %q: %w", proxy, err)
+		}
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
+
+// Logger writes an access log entry for every request. Successful requests
+// can be sampled to keep the log volume down while errors are always logged.
+func Logger(log *zap.SugaredLogger, cfg LoggerConfig) web.Middleware {
 
 	m := func(handler web.Handler) web.Handler {
 		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 
-			//traceId := "000001111" // should be part of context
-			//statusCode := http.StatusOK // should be part of context
-			//now := time.Now() // should be part of context
-
 			// If the context is missing this value, request the service
 			// to be shutdown gracefully.
 			v, err := web.GetValues(ctx)
@@ -26,16 +73,53 @@ func Logger(log *zap.SugaredLogger) web.Middleware {
 				return err //web.NewShutdownError("web value missing from context")
 			}
 
-			// LOGGING HERE
-			log.Infow("request started", "traceid", v.TraceID, "method", r.Method, "path", r.URL.Path,
-				"remoteaddr", r.RemoteAddr)
+			// Decide up front if this request is part of the sample so the
+			// started and completed entries are logged as a pair.
+			sampled := cfg.SampleEvery <= 1 || rand.Intn(cfg.SampleEvery) == 0
 
-			// Call the next handler.
-			err = handler(ctx, w, r)
+			clientIP := clientIP(r, cfg.TrustedProxies)
 
 			// LOGGING HERE
-			log.Infow("request completed", "traceid", v.TraceID, "method", r.Method, "path", r.URL.Path,
-				"remoteaddr", r.RemoteAddr, "statuscode", v.StatusCode, "since", time.Since(v.Now))
+			if sampled {
+				log.Infow("request started", "traceid", v.TraceID, "method", r.Method, "path", r.URL.Path,
+					"remoteaddr", r.RemoteAddr)
+			}
+
+			// Capture what the inner handlers write to the client and give
+			// Authenticate a place to record who made the request.
+			rw := &responseWriter{ResponseWriter: w}
+			var subject string
+			ctx = context.WithValue(ctx, subjectKey, &subject)
+
+			completed := func(failed bool) {
+				statusCode := v.StatusCode
+				if statusCode == 0 {
+					statusCode = rw.statusCode
+				}
+
+				// LOGGING HERE
+				if sampled || failed || statusCode >= http.StatusBadRequest {
+					log.Infow("request completed", "traceid", v.TraceID, "method", r.Method, "path", r.URL.Path,
+						"route", v.Route, "remoteaddr", r.RemoteAddr, "clientip", clientIP,
+						"forwardedfor", r.Header.Get("X-Forwarded-For"), "useragent", r.UserAgent(),
+						"subject", subject, "statuscode", statusCode, "bytes", rw.bytes, "since", time.Since(v.Now))
+				}
+			}
+
+			// A response aborted midway panics on its way up to net/http,
+			// it is still logged before the panic carries on.
+			defer func() {
+				if rec := recover(); rec != nil {
+					if rec == http.ErrAbortHandler {
+						completed(true)
+					}
+					panic(rec)
+				}
+			}()
+
+			// Call the next handler.
+			err = handler(ctx, rw, r)
+			completed(err != nil)
 
 			return err
 		}
@@ -44,5 +128,99 @@ func Logger(log *zap.SugaredLogger) web.Middleware {
 	}
 
 	return m
+}
+
+// =============================================================================
+
+// ctxKey represents the type of value for the context key.
+type ctxKey int
+
+// subjectKey is used to store/retrieve the authenticated subject of a request.
+const subjectKey ctxKey = 1
 
+// setSubject records the authenticated subject for the access log.
+func setSubject(ctx context.Context, subject string) {
+	if s, ok := ctx.Value(subjectKey).(*string); ok {
+		*s = subject
+	}
+}
+
+// responseWriter records the status code and number of bytes written so they
+// can be logged once the request is complete.
+type responseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	bytes      int
+}
+
+// WriteHeader captures the status code before writing it.
+func (rw *responseWriter) WriteHeader(statusCode int) {
+	rw.statusCode = statusCode
+	rw.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write counts the bytes written to the client.
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if rw.statusCode == 0 {
+		rw.statusCode = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += n
+	return n, err
+}
+
+// Flush implements the http.Flusher interface when the wrapped writer does.
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer for use by http.ResponseController.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// clientIP returns the address of the client that made the request. The
+// X-Forwarded-For header is only honoured when the request came through a
+// trusted proxy, in which case the header is walked from the right skipping
+// over the trusted proxies.
+func clientIP(r *http.Request, trusted []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !isTrusted(host, trusted) {
+		return host
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !isTrusted(hop, trusted) {
+			return hop
+		}
+		host = hop
+	}
+
+	return host
+}
+
+// isTrusted reports if the address belongs to one of the trusted networks.
+func isTrusted(addr string, trusted []*net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,151 @@
+package mid_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/piyush-saurabh/go-service/business/sys/validate"
+	"github.com/piyush-saurabh/go-service/business/web/mid"
+	"github.com/piyush-saurabh/go-service/foundation/web"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	tt := []struct {
+		name    string
+		proxies []string
+		nets    int
+		fail    bool
+	}{
+		{"addresses and ranges", []string{"10.0.0.0/8", " 192.0.2.1 ", "", "::1"}, 3, false},
+		{"a prefix that is too long", []string{"10.0.0.0/33"}, 0, true},
+		{"a truncated range", []string{"10.0.0/8"}, 0, true},
+		{"a range without a prefix", []string{"10.0.0.0/"}, 0, true},
+		{"an address out of range", []string{"300.1.1.1"}, 0, true},
+		{"a host name", []string{"proxy.internal"}, 0, true},
+	}
+
+	t.Log("Given the need to configure the trusted proxies.")
+	{
+		for testID, tc := range tt {
+			t.Logf("\tTest %d:\tWhen parsing %s.", testID, tc.name)
+			{
+				nets, err := mid.ParseTrustedProxies(tc.proxies)
+				if tc.fail {
+					if err == nil {
+						t.Fatalf("\t%s\tTest %d:\tShould reject the proxies : got %v.", failed, testID, nets)
+					}
+					t.Logf("\t%s\tTest %d:\tShould reject the proxies.", success, testID)
+					continue
+				}
+
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould parse the proxies : %v.", failed, testID, err)
+				}
+				if len(nets) != tc.nets {
+					t.Fatalf("\t%s\tTest %d:\tShould get %d networks : got %d.", failed, testID, tc.nets, len(nets))
+				}
+				t.Logf("\t%s\tTest %d:\tShould parse the proxies.", success, testID)
+			}
+		}
+	}
+}
+
+func TestLogger(t *testing.T) {
+	trusted, err := mid.ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("Should parse the trusted proxies : %v", err)
+	}
+
+	tt := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		clientIP   string
+	}{
+		{"an untrusted peer with a spoofed header", "203.0.113.7:4000", "10.0.0.1", "203.0.113.7"},
+		{"an untrusted peer claiming to be a proxy", "203.0.113.7:4000", "198.51.100.9, 10.0.0.1", "203.0.113.7"},
+		{"a chain of trusted proxies", "10.0.0.2:4000", "198.51.100.9, 192.0.2.1, 10.0.0.3", "198.51.100.9"},
+		{"a client spoofing the header behind a trusted proxy", "10.0.0.2:4000", "1.2.3.4, 198.51.100.9", "198.51.100.9"},
+		{"only trusted proxies", "10.0.0.2:4000", "10.0.0.3", "10.0.0.3"},
+		{"a trusted proxy without a header", "10.0.0.2:4000", "", "10.0.0.2"},
+	}
+
+	t.Log("Given the need to write an access log.")
+	{
+		for testID, tc := range tt {
+			t.Logf("\tTest %d:\tWhen receiving a request from %s.", testID, tc.name)
+			{
+				core, logs := observer.New(zapcore.InfoLevel)
+				log := zap.New(core).Sugar()
+
+				h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+					return web.Respond(ctx, w, nil, http.StatusNoContent)
+				}
+				app := web.NewApp(nil, mid.Logger(log, mid.LoggerConfig{TrustedProxies: trusted}))
+				app.Handle(http.MethodGet, "", "/", h)
+
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.RemoteAddr = tc.remoteAddr
+				if tc.forwarded != "" {
+					r.Header.Set("X-Forwarded-For", tc.forwarded)
+				}
+				app.ServeHTTP(httptest.NewRecorder(), r)
+
+				entries := logs.FilterMessage("request completed").All()
+				if len(entries) != 1 {
+					t.Fatalf("\t%s\tTest %d:\tShould log the request : got %d entries.", failed, testID, len(entries))
+				}
+				if got := entries[0].ContextMap()["clientip"]; got != tc.clientIP {
+					t.Fatalf("\t%s\tTest %d:\tShould log the client address %q : got %q.", failed, testID, tc.clientIP, got)
+				}
+				t.Logf("\t%s\tTest %d:\tShould log the client address %q.", success, testID, tc.clientIP)
+			}
+		}
+
+		sampled := []struct {
+			name   string
+			status int
+			err    error
+			logged bool
+		}{
+			{"a successful request", http.StatusOK, nil, false},
+			{"a rejected request", 0, validate.NewRequestError(errors.New("not found"), http.StatusNotFound), true},
+			{"a failed request", 0, errors.New("query failed"), true},
+		}
+
+		for i, tc := range sampled {
+			testID := len(tt) + i
+			t.Logf("\tTest %d:\tWhen sampling %s.", testID, tc.name)
+			{
+				core, logs := observer.New(zapcore.InfoLevel)
+				log := zap.New(core).Sugar()
+
+				h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+					if tc.err != nil {
+						return tc.err
+					}
+					return web.Respond(ctx, w, nil, tc.status)
+				}
+
+				// A sample this sparse leaves every successful request out.
+				cfg := mid.LoggerConfig{SampleEvery: math.MaxInt32}
+				app := web.NewApp(nil, mid.Logger(log, cfg), mid.Errors(zap.NewNop().Sugar()))
+				app.Handle(http.MethodGet, "", "/", h)
+				app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+				logged := logs.FilterMessage("request completed").Len() == 1
+				if logged != tc.logged {
+					t.Fatalf("\t%s\tTest %d:\tShould log the request %t : got %t.", failed, testID, tc.logged, logged)
+				}
+				t.Logf("\t%s\tTest %d:\tShould log the request %t.", success, testID, tc.logged)
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package mid
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/piyush-saurabh/go-service/business/sys/auth"
+	"github.com/piyush-saurabh/go-service/business/sys/ratelimit"
+	"github.com/piyush-saurabh/go-service/business/sys/validate"
+	"github.com/piyush-saurabh/go-service/foundation/web"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RateLimitConfig defines where the token buckets are kept and how clients
+// are identified.
+type RateLimitConfig struct {
+
+	// Store keeps the token buckets. A nil store disables rate limiting.
+	Store ratelimit.Store
+
+	// TrustedProxies is the set of networks allowed to report the client
+	// address through the X-Forwarded-For header.
+	TrustedProxies []*net.IPNet
+}
+
+// RateLimit limits the rate of requests to the routes of a group with a token
+// bucket per client. Authenticated clients are identified by the subject of
+// their claims, so the middleware goes after Authenticate, and everyone else
+// by their address. Clients going over the limit get a 429 with Retry-After.
+// The RateLimit headers let clients see how much of the limit is left.
+func RateLimit(cfg RateLimitConfig, group string, limit ratelimit.Limit) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			if cfg.Store == nil || !limit.Enabled() {
+				return handler(ctx, w, r)
+			}
+
+			key := group + ":ip:" + clientIP(r, cfg.TrustedProxies)
+			if claims, err := auth.GetClaims(ctx); err == nil {
+				key = group + ":sub:" + claims.Subject
+			}
+
+			// A store on a shared backend that can't be reached must not
+			// take the API down with it, so requests are let through.
+			res, err := cfg.Store.Take(ctx, key, limit)
+			if err != nil {
+				trace.SpanFromContext(ctx).RecordError(err)
+				return handler(ctx, w, r)
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", ceilSeconds(res.Reset))
+
+			if !res.Allowed {
+				h.Set("Retry-After", ceilSeconds(res.RetryAfter))
+				return validate.NewCodedRequestError(
+					errors.New("rate limit exceeded, try again later"),
+					http.StatusTooManyRequests,
+					validate.CodeRateLimited,
+				)
+			}
+
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// ceilSeconds formats the duration as a whole number of seconds, rounded up
+// so clients don't come back too early.
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,69 @@
+package mid_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/piyush-saurabh/go-service/business/sys/ratelimit"
+	"github.com/piyush-saurabh/go-service/business/web/mid"
+	"github.com/piyush-saurabh/go-service/foundation/web"
+	"go.uber.org/zap"
+)
+
+func TestRateLimit(t *testing.T) {
+	cfg := mid.RateLimitConfig{
+		Store: ratelimit.NewMemory(),
+	}
+	limit := ratelimit.Limit{Rate: 1.0 / 60, Burst: 2}
+
+	h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return web.Respond(ctx, w, nil, http.StatusNoContent)
+	}
+	app := web.NewApp(nil, mid.Errors(zap.NewNop().Sugar()))
+	app.Handle(http.MethodGet, "", "/", h, mid.RateLimit(cfg, "test", limit))
+
+	tt := []struct {
+		remoteAddr string
+		statusCode int
+		remaining  string
+		retryAfter string
+	}{
+		{"10.0.0.1:1234", http.StatusNoContent, "1", ""},
+		{"10.0.0.1:1234", http.StatusNoContent, "0", ""},
+		{"10.0.0.1:1234", http.StatusTooManyRequests, "0", "60"},
+		{"10.0.0.2:1234", http.StatusNoContent, "1", ""},
+	}
+
+	t.Log("Given the need to limit the rate of requests.")
+	{
+		for testID, tc := range tt {
+			t.Logf("\tTest %d:\tWhen %s makes a request.", testID, tc.remoteAddr)
+			{
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.RemoteAddr = tc.remoteAddr
+				w := httptest.NewRecorder()
+				app.ServeHTTP(w, r)
+
+				if w.Code != tc.statusCode {
+					t.Fatalf("\t%s\tTest %d:\tShould receive a status code of %d : %d.", failed, testID, tc.statusCode, w.Code)
+				}
+				t.Logf("\t%s\tTest %d:\tShould receive a status code of %d.", success, testID, tc.statusCode)
+
+				if got := w.Header().Get("RateLimit-Limit"); got != "2" {
+					t.Fatalf("\t%s\tTest %d:\tShould report the limit : got %q.", failed, testID, got)
+				}
+				if got := w.Header().Get("RateLimit-Remaining"); got != tc.remaining {
+					t.Fatalf("\t%s\tTest %d:\tShould report %s requests remaining : got %q.", failed, testID, tc.remaining, got)
+				}
+				t.Logf("\t%s\tTest %d:\tShould report %s requests remaining.", success, testID, tc.remaining)
+
+				if got := w.Header().Get("Retry-After"); got != tc.retryAfter {
+					t.Fatalf("\t%s\tTest %d:\tShould retry after %q : got %q.", failed, testID, tc.retryAfter, got)
+				}
+				t.Logf("\t%s\tTest %d:\tShould retry after %q.", success, testID, tc.retryAfter)
+			}
+		}
+	}
+}
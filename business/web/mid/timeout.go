@@ -0,0 +1,97 @@
+package mid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/piyush-saurabh/go-service/business/sys/metrics"
+	"github.com/piyush-saurabh/go-service/business/sys/validate"
+	"github.com/piyush-saurabh/go-service/foundation/web"
+)
+
+// Timeout gives the route a deadline through the request context, so work
+// like database queries is cancelled once the route took too long. Requests
+// failing because of the deadline get a 503. A timeout of 0 sets no deadline.
+func Timeout(timeout time.Duration) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			if timeout <= 0 {
+				return handler(ctx, w, r)
+			}
+
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			err := handler(ctx, w, r)
+			if err == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return err
+			}
+
+			metrics.AddTimeouts(ctx)
+
+			// A stream that was cut short has already sent its status code.
+			if errors.Is(err, web.ErrStreamAborted) {
+				return err
+			}
+
+			// The driver reports a cancelled query with its own error, so
+			// the deadline is what decides the request timed out.
+			return validate.NewCodedRequestError(
+				fmt.Errorf("request timed out after %s", timeout),
+				http.StatusServiceUnavailable,
+				validate.CodeTimeout,
+			)
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// Shed turns requests away with a 503 while the maximum number of requests
+// are in flight, so a slow dependency can't pile up requests until the
+// service runs out of memory. A maximum of 0 lets every request in.
+func Shed(max int) web.Middleware {
+	if max < 0 {
+		max = 0
+	}
+	inFlight := make(chan struct{}, max)
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			if max <= 0 {
+				return handler(ctx, w, r)
+			}
+
+			select {
+			case inFlight <- struct{}{}:
+				defer func() { <-inFlight }()
+				return handler(ctx, w, r)
+
+			default:
+				metrics.AddShed(ctx)
+				w.Header().Set("Retry-After", "1")
+				return validate.NewCodedRequestError(
+					errors.New("too many requests in flight, try again later"),
+					http.StatusServiceUnavailable,
+					validate.CodeOverloaded,
+				)
+			}
+		}
+
+		return h
+	}
+
+	return m
+}
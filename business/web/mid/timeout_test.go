@@ -0,0 +1,79 @@
+package mid_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/piyush-saurabh/go-service/business/web/mid"
+	"github.com/piyush-saurabh/go-service/foundation/web"
+	"go.uber.org/zap"
+)
+
+func TestTimeout(t *testing.T) {
+	t.Log("Given the need to bound how long requests take.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a route takes longer than its timeout.", testID)
+		{
+			h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			app := web.NewApp(nil, mid.Errors(zap.NewNop().Sugar()), mid.Metrics())
+			app.Handle(http.MethodGet, "", "/", h, mid.Timeout(10*time.Millisecond))
+
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if w.Code != http.StatusServiceUnavailable {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 503 : %d.", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 503.", success, testID)
+
+			if !strings.Contains(w.Body.String(), `"code":"REQUEST_TIMEOUT"`) {
+				t.Fatalf("\t%s\tTest %d:\tShould get the REQUEST_TIMEOUT code : %s.", failed, testID, w.Body.String())
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the REQUEST_TIMEOUT code.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen more requests are in flight than allowed.", testID)
+		{
+			started := make(chan struct{})
+			release := make(chan struct{})
+			h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+				close(started)
+				<-release
+				return web.Respond(ctx, w, nil, http.StatusNoContent)
+			}
+			app := web.NewApp(nil, mid.Errors(zap.NewNop().Sugar()), mid.Metrics(), mid.Shed(1))
+			app.Handle(http.MethodGet, "", "/", h)
+
+			done := make(chan int)
+			go func() {
+				w := httptest.NewRecorder()
+				app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+				done <- w.Code
+			}()
+			<-started
+
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			close(release)
+
+			if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+				t.Fatalf("\t%s\tTest %d:\tShould shed the request with a 503 : %d.", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould shed the request with a 503.", success, testID)
+
+			if code := <-done; code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould finish the request in flight : %d.", failed, testID, code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould finish the request in flight.", success, testID)
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"io"
 	"io/fs"
 	"path"
+	"sort"
 	"strings"
 	"sync"
 
@@ -138,3 +139,17 @@ func (ks *KeyStore) PublicKey(kid string) (*rsa.PublicKey, error) {
 	}
 	return &privateKey.PublicKey, nil
 }
+
+// KIDs returns the sorted list of key ids held by the store.
+func (ks *KeyStore) KIDs() []string {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	kids := make([]string, 0, len(ks.store))
+	for kid := range ks.store {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	return kids
+}
@@ -3,6 +3,8 @@
 package logger
 
 import (
+	"sync"
+
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -10,6 +12,13 @@ import (
 // New constructs a Sugared Logger that writes to stdout and
 // provides human readable timestamps.
 func New(service string) (*zap.SugaredLogger, error) {
+	return NewWithLevel(service, NewLevel(zapcore.InfoLevel))
+}
+
+// NewWithLevel constructs a Sugared Logger like New but the level of the
+// logger is controlled by the provided Level, so it can be changed while the
+// program is running.
+func NewWithLevel(service string, level *Level) (*zap.SugaredLogger, error) {
 	config := zap.NewProductionConfig()
 	config.OutputPaths = []string{"stdout"}
 	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
@@ -18,10 +27,146 @@ func New(service string) (*zap.SugaredLogger, error) {
 		"service": service,
 	}
 
-	log, err := config.Build()
+	// The underlying core has to accept everything so the level core can
+	// decide per entry if it should be written.
+	config.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
+
+	wrap := func(core zapcore.Core) zapcore.Core {
+		return &levelCore{Core: core, level: level}
+	}
+
+	log, err := config.Build(zap.WrapCore(wrap))
 	if err != nil {
 		return nil, err
 	}
 
 	return log.Sugar(), nil
 }
+
+// =============================================================================
+
+// traceKey is the field name used across the service to log the trace id.
+const traceKey = "traceid"
+
+// Level is an atomically changeable logging level. On top of the level it
+// tracks the set of trace ids that should be logged at debug level no matter
+// what the level is set to. Level implements http.Handler through the embedded
+// zap.AtomicLevel so the level can be changed with GET/PUT requests.
+type Level struct {
+	zap.AtomicLevel
+
+	mu     sync.RWMutex
+	traces map[string]struct{}
+}
+
+// NewLevel constructs a Level starting at the specified level.
+func NewLevel(l zapcore.Level) *Level {
+	return &Level{
+		AtomicLevel: zap.NewAtomicLevelAt(l),
+		traces:      make(map[string]struct{}),
+	}
+}
+
+// EnableTrace forces debug logging for all entries logged with the specified
+// trace id until DisableTrace is called.
+func (l *Level) EnableTrace(traceID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.traces[traceID] = struct{}{}
+}
+
+// DisableTrace stops forcing debug logging for the specified trace id.
+func (l *Level) DisableTrace(traceID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.traces, traceID)
+}
+
+// hasTraces reports if debug logging is forced for any trace id.
+func (l *Level) hasTraces() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return len(l.traces) > 0
+}
+
+// traceEnabled reports if debug logging is forced for the trace id.
+func (l *Level) traceEnabled(traceID string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	_, exists := l.traces[traceID]
+	return exists
+}
+
+// =============================================================================
+
+// levelCore filters entries based on the Level. Entries below the level are
+// only written when they carry a trace id that has debug logging forced.
+type levelCore struct {
+	zapcore.Core
+	level   *Level
+	traceID string
+}
+
+// Enabled implements the zapcore.LevelEnabler interface. Entries below the
+// level are let through while there are traces with forced debug logging since
+// the trace id is only known once the fields are written.
+func (c *levelCore) Enabled(lvl zapcore.Level) bool {
+	if c.level.Enabled(lvl) {
+		return true
+	}
+	return c.level.hasTraces()
+}
+
+// With adds structured context to the core.
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	traceID := c.traceID
+	if id, ok := findTraceID(fields); ok {
+		traceID = id
+	}
+
+	return &levelCore{
+		Core:    c.Core.With(fields),
+		level:   c.level,
+		traceID: traceID,
+	}
+}
+
+// Check determines whether the supplied entry should be logged. Entries at or
+// above the level take the normal path through the wrapped core.
+func (c *levelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.level.Enabled(ent.Level) {
+		return c.Core.Check(ent, ce)
+	}
+	if c.level.hasTraces() {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write serializes entries below the level, dropping them unless their trace
+// id has debug logging forced.
+func (c *levelCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	traceID := c.traceID
+	if id, ok := findTraceID(fields); ok {
+		traceID = id
+	}
+	if traceID == "" || !c.level.traceEnabled(traceID) {
+		return nil
+	}
+
+	return c.Core.Write(ent, fields)
+}
+
+// findTraceID looks for the trace id in the set of fields.
+func findTraceID(fields []zapcore.Field) (string, bool) {
+	for _, field := range fields {
+		if field.Key == traceKey && field.Type == zapcore.StringType {
+			return field.String, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,200 @@
+// Package client provides an HTTP client for calling other services. It
+// propagates the trace context of the current request, applies timeouts and
+// retries idempotent calls that fail for transient reasons.
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/piyush-saurabh/go-service/foundation/web"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.uber.org/zap"
+)
+
+// Config is the set of properties used to construct a Client.
+type Config struct {
+	Log          *zap.SugaredLogger
+	Timeout      time.Duration
+	MaxRetries   int
+	RetryWaitMin time.Duration
+	RetryWaitMax time.Duration
+	Transport    http.RoundTripper
+}
+
+// Client wraps an http.Client so calls to other services are traced, logged
+// and retried in a uniform way.
+type Client struct {
+	log          *zap.SugaredLogger
+	http         *http.Client
+	maxRetries   int
+	retryWaitMin time.Duration
+	retryWaitMax time.Duration
+}
+
+// New constructs a Client for making outbound calls. Zero values in the
+// config are replaced with sensible defaults, a nil logger discards the logs.
+func New(cfg Config) *Client {
+	if cfg.Log == nil {
+		cfg.Log = zap.NewNop().Sugar()
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.RetryWaitMin == 0 {
+		cfg.RetryWaitMin = 100 * time.Millisecond
+	}
+	if cfg.RetryWaitMax == 0 {
+		cfg.RetryWaitMax = 2 * time.Second
+	}
+
+	// The otelhttp transport starts a client span for every call and injects
+	// the W3C traceparent header so the trace continues in the called service.
+	// https://w3c.github.io/trace-context/
+	transport := otelhttp.NewTransport(
+		cfg.Transport,
+		otelhttp.WithPropagators(propagation.TraceContext{}),
+	)
+
+	return &Client{
+		log: cfg.Log,
+		http: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.Timeout,
+		},
+		maxRetries:   cfg.MaxRetries,
+		retryWaitMin: cfg.RetryWaitMin,
+		retryWaitMax: cfg.RetryWaitMax,
+	}
+}
+
+// Do sends the request using the provided context. Requests with an idempotent
+// method are retried with backoff when the call fails at the network level or
+// the service responds with a retryable status code.
+func (c *Client) Do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	req = req.WithContext(ctx)
+	traceID := web.GetTraceID(ctx)
+
+	c.log.Infow("client request started", "traceid", traceID, "method", req.Method, "host", req.URL.Host,
+		"path", req.URL.Path)
+
+	now := time.Now()
+	var resp *http.Response
+	var err error
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+
+			// The body was consumed by the previous attempt so a fresh
+			// copy is required before the request can be sent again.
+			if req.Body != nil && req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, fmt.Errorf("rewinding request body: %w", err)
+				}
+				req.Body = body
+			}
+		}
+
+		resp, err = c.http.Do(req)
+		if !c.shouldRetry(req, resp, err, attempt) {
+			break
+		}
+
+		wait := c.backoff(attempt)
+		c.log.Infow("client request retry", "traceid", traceID, "method", req.Method, "host", req.URL.Host,
+			"path", req.URL.Path, "attempt", attempt+1, "wait", wait, "ERROR", errOrStatus(resp, err))
+
+		// Release the connection of the failed attempt before trying again.
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	if err != nil {
+		c.log.Infow("client request completed", "traceid", traceID, "method", req.Method, "host", req.URL.Host,
+			"path", req.URL.Path, "since", time.Since(now), "ERROR", err)
+		return nil, err
+	}
+
+	c.log.Infow("client request completed", "traceid", traceID, "method", req.Method, "host", req.URL.Host,
+		"path", req.URL.Path, "statuscode", resp.StatusCode, "since", time.Since(now))
+
+	return resp, nil
+}
+
+// =============================================================================
+
+// shouldRetry decides if another attempt should be made for the request.
+func (c *Client) shouldRetry(req *http.Request, resp *http.Response, err error, attempt int) bool {
+	if attempt >= c.maxRetries || !idempotent(req.Method) {
+		return false
+	}
+
+	// A cancelled or expired context is the caller giving up, not a
+	// transient failure.
+	if req.Context().Err() != nil {
+		return false
+	}
+
+	// The body can't be replayed so the request can't be sent again.
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	if err != nil {
+		return true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// backoff calculates how long to wait before the next attempt. The wait grows
+// exponentially and has jitter added so clients don't retry in lockstep.
+func (c *Client) backoff(attempt int) time.Duration {
+	wait := c.retryWaitMin << attempt
+	if wait <= 0 || wait > c.retryWaitMax {
+		wait = c.retryWaitMax
+	}
+
+	jitter := time.Duration(rand.Int63n(int64(wait)/2 + 1))
+	return wait/2 + jitter
+}
+
+// idempotent reports whether a request with the method can be safely sent
+// more than once.
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// errOrStatus returns a value describing why an attempt failed for logging.
+func errOrStatus(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	return errors.New(resp.Status)
+}
@@ -0,0 +1,125 @@
+package client_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/piyush-saurabh/go-service/foundation/web/client"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestClient(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("traceparent") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	c := client.New(client.Config{
+		Log:          zap.NewNop().Sugar(),
+		MaxRetries:   3,
+		RetryWaitMin: time.Millisecond,
+		RetryWaitMax: 5 * time.Millisecond,
+	})
+
+	t.Log("Given the need to call other services.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen calling a service with an idempotent method.", testID)
+		{
+			req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct a request: %v", failed, testID, err)
+			}
+
+			// Simulate being inside a traced request so there is a trace
+			// context to propagate.
+			sc := trace.NewSpanContext(trace.SpanContextConfig{
+				TraceID:    trace.TraceID{0x01},
+				SpanID:     trace.SpanID{0x01},
+				TraceFlags: trace.FlagsSampled,
+			})
+			ctx := trace.ContextWithSpanContext(context.Background(), sc)
+
+			resp, err := c.Do(ctx, req)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to make the call: %v", failed, testID, err)
+			}
+			resp.Body.Close()
+			t.Logf("\t%s\tTest %d:\tShould be able to make the call.", success, testID)
+
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 after retrying : %v", failed, testID, resp.StatusCode)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 200 after retrying.", success, testID)
+
+			if got := atomic.LoadInt32(&calls); got != 3 {
+				t.Fatalf("\t%s\tTest %d:\tShould have made 3 attempts : %d", failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould have made 3 attempts.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen calling a service with a non-idempotent method.", testID)
+		{
+			atomic.StoreInt32(&calls, 0)
+
+			req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{}`))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct a request: %v", failed, testID, err)
+			}
+
+			resp, err := c.Do(context.Background(), req)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to make the call: %v", failed, testID, err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != http.StatusServiceUnavailable {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 503 without retrying : %v", failed, testID, resp.StatusCode)
+			}
+			if got := atomic.LoadInt32(&calls); got != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould have made 1 attempt : %d", failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not retry the call.", success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen calling a service with a zero config.", testID)
+		{
+			atomic.StoreInt32(&calls, 3)
+
+			req, err := http.NewRequest(http.MethodPost, srv.URL, nil)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct a request: %v", failed, testID, err)
+			}
+
+			resp, err := client.New(client.Config{}).Do(context.Background(), req)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to make the call: %v", failed, testID, err)
+			}
+			resp.Body.Close()
+			t.Logf("\t%s\tTest %d:\tShould be able to make the call.", success, testID)
+		}
+	}
+}
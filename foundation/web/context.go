@@ -13,11 +13,18 @@ type ctxKey int
 // [PS] context key should be of unique datatype so that it cannot be overwritten by other, so it has a unique type
 const key ctxKey = 1
 
+// checkKey is how the function Decode checks decoded structs with is
+// stored/retrieved.
+const checkKey ctxKey = 2
+
 // Values represent state for each request.
 type Values struct {
 	TraceID    string
+	Route      string
 	Now        time.Time
 	StatusCode int
+	Accept     string // Accept header, used by Respond to pick the encoding
+	Pretty     bool   // indent JSON responses, set with the pretty query parameter
 }
 
 // GetValues returns the values from the context.
@@ -0,0 +1,292 @@
+package web
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Set of content types with a registered encoder.
+const (
+	ContentTypeJSON    = "application/json"
+	ContentTypeCSV     = "text/csv"
+	ContentTypeMsgPack = "application/msgpack"
+)
+
+// Set of errors returned when encoding responses.
+var (
+	ErrNotAcceptable = errors.New("none of the accepted content types can be produced")
+	ErrNotEncodable  = errors.New("value can't be encoded in the content type")
+)
+
+// Encoder converts a Go value into the bytes of a response. Encoders return
+// ErrNotEncodable for values they don't support, like CSV for a single user,
+// so the next content type the client accepts can be tried.
+type Encoder func(data interface{}) ([]byte, error)
+
+// encoders holds the registered encoders in the order they were registered.
+// The first one is used when the client accepts anything.
+var encoders = struct {
+	sync.RWMutex
+	types []string
+	m     map[string]Encoder
+}{
+	types: []string{ContentTypeJSON, ContentTypeCSV, ContentTypeMsgPack},
+	m: map[string]Encoder{
+		ContentTypeJSON:    json.Marshal,
+		ContentTypeCSV:     encodeCSV,
+		ContentTypeMsgPack: encodeMsgPack,
+	},
+}
+
+// RegisterEncoder adds an encoder for the content type, replacing the encoder
+// if one is already registered.
+func RegisterEncoder(contentType string, enc Encoder) {
+	encoders.Lock()
+	defer encoders.Unlock()
+
+	if _, exists := encoders.m[contentType]; !exists {
+		encoders.types = append(encoders.types, contentType)
+	}
+	encoders.m[contentType] = enc
+}
+
+// encodePretty is used in place of the JSON encoder when the client asked
+// for an indented document.
+func encodePretty(data interface{}) ([]byte, error) {
+	return json.MarshalIndent(data, "", "  ")
+}
+
+// accepted is a media range from the Accept header.
+type accepted struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept returns the media ranges of the Accept header with the most
+// preferred first. Ranges with a quality of 0 are kept at the end, they
+// refuse the content types they match.
+func parseAccept(accept string) []accepted {
+	var ranges []accepted
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, exists := params["q"]; exists {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, accepted{mediaType, q})
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+
+	return ranges
+}
+
+// negotiate encodes the value using the first content type that is both
+// accepted by the client and able to encode the value. Without an Accept
+// header the value is encoded as JSON.
+func negotiate(accept string, pretty bool, data interface{}) ([]byte, string, error) {
+	if strings.TrimSpace(accept) == "" {
+		accept = "*/*"
+	}
+
+	encoders.RLock()
+	defer encoders.RUnlock()
+
+	ranges := parseAccept(accept)
+	for _, r := range ranges {
+		if r.q <= 0 {
+			break
+		}
+
+		for _, contentType := range encoders.types {
+			if !matchMediaType(r.mediaType, contentType) || !acceptable(ranges, contentType) {
+				continue
+			}
+
+			enc := encoders.m[contentType]
+			if pretty && contentType == ContentTypeJSON {
+				enc = encodePretty
+			}
+
+			b, err := enc(data)
+			switch {
+			case errors.Is(err, ErrNotEncodable):
+				continue
+			case err != nil:
+				return nil, "", err
+			}
+			return b, contentType, nil
+		}
+	}
+
+	return nil, "", ErrNotAcceptable
+}
+
+// acceptable reports if the client didn't refuse the content type. The most
+// specific range matching the content type decides, so application/json;q=0
+// refuses JSON even when */* is accepted.
+func acceptable(ranges []accepted, contentType string) bool {
+	best, q := -1, 0.0
+	for _, r := range ranges {
+		if !matchMediaType(r.mediaType, contentType) {
+			continue
+		}
+
+		specificity := 2
+		switch {
+		case r.mediaType == "*/*":
+			specificity = 0
+		case strings.HasSuffix(r.mediaType, "/*"):
+			specificity = 1
+		}
+
+		if specificity > best {
+			best, q = specificity, r.q
+		}
+	}
+	return q > 0
+}
+
+// matchMediaType reports if the media range from an Accept header includes
+// the content type.
+func matchMediaType(mediaRange string, contentType string) bool {
+	switch {
+	case mediaRange == "*/*":
+		return true
+	case strings.HasSuffix(mediaRange, "/*"):
+		return strings.HasPrefix(contentType, strings.TrimSuffix(mediaRange, "*"))
+	}
+	return mediaRange == contentType
+}
+
+// =============================================================================
+
+// encodeCSV encodes a slice of structs as CSV with a header row. The columns
+// are the JSON names of the fields, and the values are the JSON values with
+// arrays joined by commas, so the CSV carries the same data as the JSON.
+func encodeCSV(data interface{}) ([]byte, error) {
+	v := reflect.ValueOf(data)
+	if v.Kind() != reflect.Slice {
+		return nil, ErrNotEncodable
+	}
+
+	elem := v.Type().Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		return nil, ErrNotEncodable
+	}
+
+	// Collect the columns from the JSON names of the exported fields.
+	var header []string
+	var fields []int
+	for i := 0; i < elem.NumField(); i++ {
+		f := elem.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		header = append(header, name)
+		fields = append(fields, i)
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		row := reflect.Indirect(v.Index(i))
+		record := make([]string, len(fields))
+		if row.IsValid() {
+			for j, field := range fields {
+				s, err := csvValue(row.Field(field).Interface())
+				if err != nil {
+					return nil, fmt.Errorf("column %s: %w", header[j], err)
+				}
+				record[j] = s
+			}
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// csvValue formats a field the way it looks in the JSON document.
+func csvValue(field interface{}) (string, error) {
+	b, err := json.Marshal(field)
+	if err != nil {
+		return "", err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	var val interface{}
+	if err := decoder.Decode(&val); err != nil {
+		return "", err
+	}
+
+	switch val := val.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return csvText(val), nil
+	case json.Number:
+		return val.String(), nil
+	case bool:
+		return strconv.FormatBool(val), nil
+	case []interface{}:
+		items := make([]string, len(val))
+		for i, item := range val {
+			s, err := csvValue(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return strings.Join(items, ","), nil
+	}
+
+	return string(b), nil
+}
+
+// csvText keeps spreadsheets from running text as a formula when the CSV is
+// opened, by prefixing text that starts like a formula with a quote.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,191 @@
+package web
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// encodeMsgPack encodes a value as MessagePack. The value is marshaled to
+// JSON first so the MessagePack document has the same fields, names and
+// order as the JSON one, including times which stay RFC 3339 strings.
+func encodeMsgPack(data interface{}) ([]byte, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+
+	val, err := jsonValue(decoder)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := msgpackWrite(&buf, val); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// object keeps the members of a JSON object in their order.
+type object struct {
+	keys   []string
+	values []interface{}
+}
+
+// jsonValue reads the next JSON value from the decoder into nil, bool,
+// json.Number, string, []interface{} or object values.
+func jsonValue(decoder *json.Decoder) (interface{}, error) {
+	tok, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('['):
+		arr := []interface{}{}
+		for decoder.More() {
+			v, err := jsonValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		return arr, nil
+
+	case json.Delim('{'):
+		var obj object
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := jsonValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			obj.keys = append(obj.keys, key.(string))
+			obj.values = append(obj.values, v)
+		}
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		return obj, nil
+	}
+
+	return tok, nil
+}
+
+// msgpackWrite writes the value as MessagePack.
+func msgpackWrite(buf *bytes.Buffer, val interface{}) error {
+	switch val := val.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+
+	case bool:
+		if val {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+
+	case json.Number:
+		if n, err := val.Int64(); err == nil {
+			msgpackInt(buf, n)
+			return nil
+		}
+		f, err := val.Float64()
+		if err != nil {
+			return fmt.Errorf("encoding number %s: %w", val, err)
+		}
+		buf.WriteByte(0xcb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+
+	case string:
+		n := len(val)
+		switch {
+		case n < 32:
+			buf.WriteByte(0xa0 | byte(n))
+		case n <= math.MaxUint8:
+			buf.WriteByte(0xd9)
+			buf.WriteByte(byte(n))
+		case n <= math.MaxUint16:
+			buf.WriteByte(0xda)
+			binary.Write(buf, binary.BigEndian, uint16(n))
+		default:
+			buf.WriteByte(0xdb)
+			binary.Write(buf, binary.BigEndian, uint32(n))
+		}
+		buf.WriteString(val)
+
+	case []interface{}:
+		msgpackHeader(buf, len(val), 0x90, 0xdc, 0xdd)
+		for _, v := range val {
+			if err := msgpackWrite(buf, v); err != nil {
+				return err
+			}
+		}
+
+	case object:
+		msgpackHeader(buf, len(val.keys), 0x80, 0xde, 0xdf)
+		for i, key := range val.keys {
+			if err := msgpackWrite(buf, key); err != nil {
+				return err
+			}
+			if err := msgpackWrite(buf, val.values[i]); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("encoding %T: %w", val, ErrNotEncodable)
+	}
+
+	return nil
+}
+
+// msgpackInt writes the integer in the smallest MessagePack form.
+func msgpackInt(buf *bytes.Buffer, n int64) {
+	switch {
+	case n >= 0 && n <= math.MaxInt8:
+		buf.WriteByte(byte(n))
+	case n < 0 && n >= -32:
+		buf.WriteByte(byte(n))
+	case n >= math.MinInt8 && n <= math.MaxInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte(byte(n))
+	case n >= math.MinInt16 && n <= math.MaxInt16:
+		buf.WriteByte(0xd1)
+		binary.Write(buf, binary.BigEndian, int16(n))
+	case n >= math.MinInt32 && n <= math.MaxInt32:
+		buf.WriteByte(0xd2)
+		binary.Write(buf, binary.BigEndian, int32(n))
+	default:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
+
+// msgpackHeader writes the header of an array or map with n elements using
+// the fix, 16 bit or 32 bit form.
+func msgpackHeader(buf *bytes.Buffer, n int, fix byte, b16 byte, b32 byte) {
+	switch {
+	case n < 16:
+		buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(b16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(b32)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
@@ -0,0 +1,69 @@
+package web_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/piyush-saurabh/go-service/foundation/web"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestPatch(t *testing.T) {
+	const doc = `{"name":"Bill","email":"bill@example.com","roles":["USER"]}`
+
+	tt := []struct {
+		name        string
+		contentType string
+		patch       string
+		exp         string
+		err         error
+	}{
+		{"merge replace", web.ContentTypeMergePatch, `{"name":"Jill"}`, `{"name":"Jill","email":"bill@example.com","roles":["USER"]}`, nil},
+		{"merge remove", web.ContentTypeMergePatch, `{"email":null}`, `{"name":"Bill","roles":["USER"]}`, nil},
+		{"merge array", web.ContentTypeMergePatch, `{"roles":["ADMIN"]}`, `{"name":"Bill","email":"bill@example.com","roles":["ADMIN"]}`, nil},
+		{"json add", web.ContentTypeJSONPatch, `[{"op":"add","path":"/roles/-","value":"ADMIN"}]`, `{"name":"Bill","email":"bill@example.com","roles":["USER","ADMIN"]}`, nil},
+		{"json replace", web.ContentTypeJSONPatch, `[{"op":"replace","path":"/roles/0","value":"ADMIN"}]`, `{"name":"Bill","email":"bill@example.com","roles":["ADMIN"]}`, nil},
+		{"json remove", web.ContentTypeJSONPatch, `[{"op":"remove","path":"/email"}]`, `{"name":"Bill","roles":["USER"]}`, nil},
+		{"json move", web.ContentTypeJSONPatch, `[{"op":"move","from":"/name","path":"/email"}]`, `{"email":"Bill","roles":["USER"]}`, nil},
+		{"json copy", web.ContentTypeJSONPatch, `[{"op":"copy","from":"/roles/0","path":"/roles/1"}]`, `{"name":"Bill","email":"bill@example.com","roles":["USER","USER"]}`, nil},
+		{"json test", web.ContentTypeJSONPatch, `[{"op":"test","path":"/name","value":"Bill"},{"op":"replace","path":"/name","value":"Jill"}]`, `{"name":"Jill","email":"bill@example.com","roles":["USER"]}`, nil},
+		{"json test failed", web.ContentTypeJSONPatch, `[{"op":"test","path":"/name","value":"Jill"}]`, "", web.ErrPatchTestFailed},
+		{"json missing path", web.ContentTypeJSONPatch, `[{"op":"replace","path":"/phone","value":"555"}]`, "", web.ErrInvalidPatch},
+		{"json unknown op", web.ContentTypeJSONPatch, `[{"op":"upsert","path":"/name","value":"Jill"}]`, "", web.ErrInvalidPatch},
+	}
+
+	t.Log("Given the need to apply patch documents.")
+	{
+		for testID, tc := range tt {
+			t.Logf("\tTest %d:\tWhen applying a %s patch.", testID, tc.name)
+			{
+				got, err := web.ApplyPatch(tc.contentType, []byte(doc), []byte(tc.patch))
+				if tc.err != nil {
+					if !errors.Is(err, tc.err) {
+						t.Fatalf("\t%s\tTest %d:\tShould fail with %v : %v.", failed, testID, tc.err, err)
+					}
+					t.Logf("\t%s\tTest %d:\tShould fail with %v.", success, testID, tc.err)
+					continue
+				}
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to apply the patch : %v.", failed, testID, err)
+				}
+
+				var gotDoc, expDoc interface{}
+				json.Unmarshal(got, &gotDoc)
+				json.Unmarshal([]byte(tc.exp), &expDoc)
+				if !reflect.DeepEqual(gotDoc, expDoc) {
+					t.Fatalf("\t%s\tTest %d:\tShould get the patched document : got %s, exp %s.", failed, testID, got, tc.exp)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get the patched document.", success, testID)
+			}
+		}
+	}
+}
@@ -1,12 +1,48 @@
 package web
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"reflect"
+	"strings"
 
 	"github.com/dimfeld/httptreemux/v5"
 )
 
+// DefaultMaxBodySize is the largest request body that is read unless the app
+// or the route sets a different limit.
+const DefaultMaxBodySize int64 = 1 << 20
+
+// Set of errors returned when reading request bodies.
+var (
+	ErrUnsupportedMediaType = errors.New("content type must be application/json")
+	ErrBodyTooLarge         = errors.New("request body too large")
+)
+
+// DecodeError is returned by Decode when the body is not a valid JSON
+// document for the value. Field is set when the problem is with a specific
+// field of the document.
+type DecodeError struct {
+	Field string
+	Msg   string
+}
+
+// Error implements the error interface.
+func (err *DecodeError) Error() string {
+	return err.Msg
+}
+
+// Validator is implemented by values that check business rules, like rules
+// across fields, once they are decoded. The error is returned by Decode as is.
+type Validator interface {
+	Validate() error
+}
+
 // Param returns the web call parameters from the request.
 func Param(r *http.Request, key string) string {
 	m := httptreemux.ContextParams(r.Context())
@@ -16,13 +52,166 @@ func Param(r *http.Request, key string) string {
 // Decode reads the body of an HTTP request looking for a JSON document. The
 // body is decoded into the provided value.
 //
-// If the provided value is a struct then it is checked for validation tags.
+// If the provided value is a struct then it is checked for validation tags
+// with the function set on the App by SetCheck. Values implementing Validator
+// are then validated as well.
+//
+// The body must hold a single JSON document with only known fields. A
+// Content-Type, when provided, must be a JSON media type.
 func Decode(r *http.Request, val interface{}) error {
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err != nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+			return ErrUnsupportedMediaType
+		}
+	}
+
 	decoder := json.NewDecoder(r.Body)
 	decoder.DisallowUnknownFields()
 	if err := decoder.Decode(val); err != nil {
+		return decodeError(err)
+	}
+
+	// Anything but whitespace after the document is rejected.
+	if _, err := decoder.Token(); err != io.EOF {
+		if errors.Is(err, ErrBodyTooLarge) {
+			return err
+		}
+		return &DecodeError{Msg: "body must only contain a single JSON document"}
+	}
+
+	check, _ := r.Context().Value(checkKey).(func(val interface{}) error)
+	if check != nil && reflect.Indirect(reflect.ValueOf(val)).Kind() == reflect.Struct {
+		if err := check(val); err != nil {
+			return err
+		}
+	}
+
+	if v, ok := val.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeError translates the errors of the JSON decoder into errors that can
+// be shown to the client. Errors that aren't caused by the body are returned
+// unchanged.
+func decodeError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.Is(err, ErrBodyTooLarge):
+		return err
+
+	case errors.Is(err, io.EOF):
+		return &DecodeError{Msg: "body must not be empty"}
+
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &DecodeError{Msg: "body contains badly-formed JSON"}
+
+	case errors.As(err, &syntaxErr):
+		return &DecodeError{Msg: fmt.Sprintf("body contains badly-formed JSON (at character %d)", syntaxErr.Offset)}
+
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return &DecodeError{Msg: fmt.Sprintf("body must be of type %s", typeErr.Type)}
+		}
+		return &DecodeError{
+			Field: typeErr.Field,
+			Msg:   fmt.Sprintf("%s must be of type %s", typeErr.Field, typeErr.Type),
+		}
+
+	// The decoder has no error type for unknown fields.
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return &DecodeError{
+			Field: field,
+			Msg:   fmt.Sprintf("%s is not a known field", field),
+		}
+	}
+
+	return err
+}
+
+// =============================================================================
+
+// MaxBodySize returns a middleware that replaces the app's limit on the size
+// of request bodies for a route. A limit of zero or less removes the limit.
+func MaxBodySize(n int64) Middleware {
+	m := func(handler Handler) Handler {
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			r.Body = limitBody(r.Body, n)
+			return handler(ctx, w, r)
+		}
+		return h
+	}
+	return m
+}
+
+// WrapBody replaces the body of the request with the one returned by fn, like
+// a decompressing reader. The size limit on the body keeps applying to what
+// is read through the new body as well.
+func WrapBody(r *http.Request, fn func(body io.ReadCloser) (io.ReadCloser, error)) error {
+	body, err := fn(r.Body)
+	if err != nil {
 		return err
 	}
 
+	if lb, ok := r.Body.(*limitedBody); ok {
+		body = limitBody(body, lb.limit)
+	}
+	r.Body = body
+
 	return nil
 }
+
+// limitedBody is a request body that fails with ErrBodyTooLarge once more
+// than the limit has been read from it.
+type limitedBody struct {
+	body      io.ReadCloser
+	limit     int64
+	remaining int64
+}
+
+// limitBody limits the body to n bytes. A body that is already limited has
+// its limit replaced, so routes can raise the limit set by the app.
+func limitBody(body io.ReadCloser, n int64) io.ReadCloser {
+	if lb, ok := body.(*limitedBody); ok {
+		body = lb.body
+	}
+	if n <= 0 || body == nil {
+		return body
+	}
+	return &limitedBody{body: body, limit: n, remaining: n}
+}
+
+// Read implements the io.Reader interface.
+func (lb *limitedBody) Read(p []byte) (int, error) {
+
+	// Once the limit is reached, a single byte more means the body is too
+	// large, while the end of the body means it fit exactly.
+	if lb.remaining <= 0 {
+		var b [1]byte
+		n, err := lb.body.Read(b[:])
+		if n > 0 {
+			return 0, ErrBodyTooLarge
+		}
+		return 0, err
+	}
+
+	if int64(len(p)) > lb.remaining {
+		p = p[:lb.remaining]
+	}
+	n, err := lb.body.Read(p)
+	lb.remaining -= int64(n)
+	return n, err
+}
+
+// Close implements the io.Closer interface.
+func (lb *limitedBody) Close() error {
+	return lb.body.Close()
+}
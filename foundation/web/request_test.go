@@ -0,0 +1,109 @@
+package web_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/piyush-saurabh/go-service/foundation/web"
+)
+
+// Set of errors returned when validating a decodeUser.
+var (
+	errUnknownRole = errors.New("unknown role")
+	errMissingName = errors.New("missing name")
+)
+
+// checkName stands in for the check set on the App, it requires a name.
+func checkName(val interface{}) error {
+	if u, ok := val.(*decodeUser); ok && u.Name == "" {
+		return errMissingName
+	}
+	return nil
+}
+
+// decodeUser is the document decoded by the tests.
+type decodeUser struct {
+	Name  string   `json:"name"`
+	Roles []string `json:"roles"`
+}
+
+// Validate implements the web.Validator interface.
+func (u decodeUser) Validate() error {
+	for _, role := range u.Roles {
+		if role != "USER" {
+			return errUnknownRole
+		}
+	}
+	return nil
+}
+
+func TestDecode(t *testing.T) {
+	tt := []struct {
+		name        string
+		contentType string
+		body        string
+		field       string
+		err         error
+	}{
+		{"a valid document", "application/json", `{"name":"Bill","roles":["USER"]}`, "", nil},
+		{"no content type", "", `{"name":"Bill"}`, "", nil},
+		{"a form", "application/x-www-form-urlencoded", `name=Bill`, "", web.ErrUnsupportedMediaType},
+		{"an oversized body", "application/json", `{"name":"` + strings.Repeat("B", 64) + `"}`, "", web.ErrBodyTooLarge},
+		{"an empty body", "application/json", ``, "", &web.DecodeError{}},
+		{"trailing data", "application/json", `{"name":"Bill"}{"name":"Jill"}`, "", &web.DecodeError{}},
+		{"a wrong type", "application/json", `{"name":"Bill","roles":"USER"}`, "roles", &web.DecodeError{}},
+		{"an unknown role", "application/json", `{"name":"Bill","roles":["ROOT"]}`, "", errUnknownRole},
+		{"a missing name", "application/json", `{"roles":["USER"]}`, "", errMissingName},
+		{"an unknown field", "application/json", `{"name":"Bill","email":"bill@example.com"}`, "email", &web.DecodeError{}},
+	}
+
+	t.Log("Given the need to decode request bodies.")
+	{
+		for testID, tc := range tt {
+			t.Logf("\tTest %d:\tWhen decoding %s.", testID, tc.name)
+			{
+				r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+				if tc.contentType != "" {
+					r.Header.Set("Content-Type", tc.contentType)
+				}
+
+				var err error
+				h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+					var u decodeUser
+					err = web.Decode(r, &u)
+					return nil
+				}
+				app := web.NewApp(nil)
+				app.SetMaxBodySize(1 << 10)
+				app.SetCheck(checkName)
+				app.Handle(http.MethodPost, "", "/", h, web.MaxBodySize(64))
+				app.ServeHTTP(httptest.NewRecorder(), r)
+
+				var decodeErr *web.DecodeError
+				switch {
+				case tc.err == nil:
+					if err != nil {
+						t.Fatalf("\t%s\tTest %d:\tShould be able to decode the body : %v.", failed, testID, err)
+					}
+					t.Logf("\t%s\tTest %d:\tShould be able to decode the body.", success, testID)
+
+				case errors.As(tc.err, &decodeErr):
+					if !errors.As(err, &decodeErr) || decodeErr.Field != tc.field {
+						t.Fatalf("\t%s\tTest %d:\tShould fail to decode field %q : %v.", failed, testID, tc.field, err)
+					}
+					t.Logf("\t%s\tTest %d:\tShould fail to decode field %q.", success, testID, tc.field)
+
+				default:
+					if !errors.Is(err, tc.err) {
+						t.Fatalf("\t%s\tTest %d:\tShould fail with %v : %v.", failed, testID, tc.err, err)
+					}
+					t.Logf("\t%s\tTest %d:\tShould fail with %v.", success, testID, tc.err)
+				}
+			}
+		}
+	}
+}
@@ -6,14 +6,45 @@ import (
 	"net/http"
 )
 
-// Respond converts a Go value to JSON and sends it to the client.
+// Respond converts a Go value to the content type the client accepts and
+// sends it to the client. JSON is used when the client accepts anything, and
+// ErrNotAcceptable is returned when none of the accepted types can encode the
+// value.
 func Respond(ctx context.Context, w http.ResponseWriter, data interface{}, statusCode int) error {
 
-	// Set the status code for the request logger middleware.
-	SetStatusCode(ctx, statusCode)
+	// If there is nothing to marshal then set status code and return.
+	if statusCode == http.StatusNoContent {
+		SetStatusCode(ctx, statusCode)
+		w.WriteHeader(statusCode)
+		return nil
+	}
+
+	var accept string
+	var pretty bool
+	if v, err := GetValues(ctx); err == nil {
+		accept = v.Accept
+		pretty = v.Pretty
+	}
+
+	// Convert the response value to the negotiated content type.
+	encoded, contentType, err := negotiate(accept, pretty, data)
+	if err != nil {
+		return err
+	}
+
+	// The response depends on the Accept header, so caches must key on it.
+	w.Header().Add("Vary", "Accept")
+
+	return write(ctx, w, encoded, statusCode, contentType)
+}
+
+// RespondAs converts a Go value to JSON and sends it to the client with the
+// provided content type, for JSON based media types like problem+json.
+func RespondAs(ctx context.Context, w http.ResponseWriter, data interface{}, statusCode int, contentType string) error {
 
 	// If there is nothing to marshal then set status code and return.
 	if statusCode == http.StatusNoContent {
+		SetStatusCode(ctx, statusCode)
 		w.WriteHeader(statusCode)
 		return nil
 	}
@@ -24,14 +55,23 @@ func Respond(ctx context.Context, w http.ResponseWriter, data interface{}, statu
 		return err
 	}
 
+	return write(ctx, w, jsonData, statusCode, contentType)
+}
+
+// write sends the encoded response to the client.
+func write(ctx context.Context, w http.ResponseWriter, data []byte, statusCode int, contentType string) error {
+
+	// Set the status code for the request logger middleware.
+	SetStatusCode(ctx, statusCode)
+
 	// Set the content type and headers once we know marshaling has succeeded.
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", contentType)
 
 	// Write the status code to the response.
 	w.WriteHeader(statusCode)
 
 	// Send the result back to the client.
-	if _, err := w.Write(jsonData); err != nil {
+	if _, err := w.Write(data); err != nil {
 		return err
 	}
 
@@ -0,0 +1,92 @@
+package web_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/piyush-saurabh/go-service/foundation/web"
+)
+
+// respondUser is the document sent by the tests.
+type respondUser struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Roles    []string `json:"roles"`
+	Password string   `json:"-"`
+}
+
+func TestRespond(t *testing.T) {
+	users := []respondUser{
+		{ID: "1", Name: "Bill", Roles: []string{"ADMIN", "USER"}, Password: "gophers"},
+		{ID: "2", Name: "Jill, Smith", Roles: []string{"USER"}},
+	}
+
+	tt := []struct {
+		name        string
+		accept      string
+		query       string
+		data        interface{}
+		contentType string
+		body        string
+		err         error
+	}{
+		{"no accept header", "", "", users[:1], "application/json", `[{"id":"1","name":"Bill","roles":["ADMIN","USER"]}]`, nil},
+		{"any type", "text/html, */*;q=0.8", "", users[:1], "application/json", `[{"id":"1","name":"Bill","roles":["ADMIN","USER"]}]`, nil},
+		{"csv", "text/csv", "", users, "text/csv", "id,name,roles\n1,Bill,\"ADMIN,USER\"\n2,\"Jill, Smith\",USER\n", nil},
+		{"csv before json", "application/json;q=0.5, text/csv", "", users[1:], "text/csv", "id,name,roles\n2,\"Jill, Smith\",USER\n", nil},
+		{"csv for a single user", "text/csv, application/json;q=0.1", "", users[0], "application/json", `{"id":"1","name":"Bill","roles":["ADMIN","USER"]}`, nil},
+		{"msgpack", "application/msgpack", "", respondUser{ID: "1"}, "application/msgpack", "\x83\xa2id\xa11\xa4name\xa0\xa5roles\xc0", nil},
+		{"pretty json", "application/json", "?pretty=true", respondUser{ID: "1"}, "application/json", "{\n  \"id\": \"1\",\n  \"name\": \"\",\n  \"roles\": null\n}", nil},
+		{"csv with a formula", "text/csv", "", []respondUser{{ID: "3", Name: "=1+2"}}, "text/csv", "id,name,roles\n3,'=1+2,\n", nil},
+		{"json refused", "application/json;q=0, */*", "", users[1:], "text/csv", "id,name,roles\n2,\"Jill, Smith\",USER\n", nil},
+		{"an unsupported type", "application/xml", "", users, "", "", web.ErrNotAcceptable},
+		{"csv only for a single user", "text/csv", "", users[0], "", "", web.ErrNotAcceptable},
+	}
+
+	t.Log("Given the need to respond in the content type the client accepts.")
+	{
+		for testID, tc := range tt {
+			t.Logf("\tTest %d:\tWhen responding with %s.", testID, tc.name)
+			{
+				r := httptest.NewRequest(http.MethodGet, "/"+tc.query, nil)
+				if tc.accept != "" {
+					r.Header.Set("Accept", tc.accept)
+				}
+				w := httptest.NewRecorder()
+
+				var err error
+				h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+					err = web.Respond(ctx, w, tc.data, http.StatusOK)
+					return nil
+				}
+				app := web.NewApp(nil)
+				app.Handle(http.MethodGet, "", "/", h)
+				app.ServeHTTP(w, r)
+
+				if tc.err != nil {
+					if !errors.Is(err, tc.err) {
+						t.Fatalf("\t%s\tTest %d:\tShould fail with %v : %v.", failed, testID, tc.err, err)
+					}
+					t.Logf("\t%s\tTest %d:\tShould fail with %v.", success, testID, tc.err)
+					continue
+				}
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to respond : %v.", failed, testID, err)
+				}
+
+				if ct := w.Header().Get("Content-Type"); ct != tc.contentType {
+					t.Fatalf("\t%s\tTest %d:\tShould respond with %s : got %s.", failed, testID, tc.contentType, ct)
+				}
+				t.Logf("\t%s\tTest %d:\tShould respond with %s.", success, testID, tc.contentType)
+
+				if got := w.Body.String(); got != tc.body {
+					t.Fatalf("\t%s\tTest %d:\tShould get the encoded body : got %q, exp %q.", failed, testID, got, tc.body)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get the encoded body.", success, testID)
+			}
+		}
+	}
+}
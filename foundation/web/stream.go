@@ -0,0 +1,144 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ContentTypeNDJSON is the media type of newline delimited JSON streams.
+const ContentTypeNDJSON = "application/x-ndjson"
+
+// ErrStreamAborted is returned by RespondStream when the stream fails after
+// the response was started. The status code has already been sent, so the
+// error can only be logged and the connection aborted.
+var ErrStreamAborted = errors.New("stream aborted after the response was started")
+
+// flushEvery is the number of values written between flushes to the client.
+const flushEvery = 100
+
+// StreamFunc produces the values of a streamed response by calling send with
+// each of them. Values are written as they are sent, so send must not be
+// called with a value that is changed before send returns.
+type StreamFunc func(send func(v interface{}) error) error
+
+// RespondStream sends the values produced by the stream to the client as they
+// are produced, as a JSON array or as NDJSON when the client accepts it, so
+// result sets of any size use constant memory. The response is started with
+// the first value, until then errors from the stream are returned as is. The
+// stream stops once the client goes away.
+func RespondStream(ctx context.Context, w http.ResponseWriter, statusCode int, stream StreamFunc) error {
+	var accept string
+	if v, err := GetValues(ctx); err == nil {
+		accept = v.Accept
+	}
+
+	ndjson, err := negotiateStream(accept)
+	if err != nil {
+		return err
+	}
+
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	var sent int
+	start := func() {
+		SetStatusCode(ctx, statusCode)
+		w.Header().Add("Vary", "Accept")
+		if ndjson {
+			w.Header().Set("Content-Type", ContentTypeNDJSON)
+			w.WriteHeader(statusCode)
+			return
+		}
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		w.WriteHeader(statusCode)
+		w.Write([]byte("["))
+	}
+
+	send := func(v interface{}) error {
+
+		// Stop producing values once the client has gone away.
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case sent == 0:
+			start()
+		case !ndjson:
+			b = append([]byte(","), b...)
+		}
+		if ndjson {
+			b = append(b, '\n')
+		}
+
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+
+		sent++
+		if sent%flushEvery == 0 {
+			flush()
+		}
+
+		return nil
+	}
+
+	if err := stream(send); err != nil {
+		if sent == 0 {
+			return err
+		}
+
+		// The JSON array is left open so clients can't mistake the partial
+		// response for a complete one.
+		flush()
+		return fmt.Errorf("%w: after %d values: %v", ErrStreamAborted, sent, err)
+	}
+
+	if sent == 0 {
+		start()
+	}
+	if !ndjson {
+		w.Write([]byte("]"))
+	}
+	flush()
+
+	return nil
+}
+
+// negotiateStream reports if the stream is sent as NDJSON rather than as a
+// JSON array, based on the content types the client accepts.
+func negotiateStream(accept string) (bool, error) {
+	if accept == "" {
+		return false, nil
+	}
+
+	ranges := parseAccept(accept)
+	for _, r := range ranges {
+		if r.q <= 0 {
+			break
+		}
+
+		switch {
+		case r.mediaType == ContentTypeNDJSON && acceptable(ranges, ContentTypeNDJSON):
+			return true, nil
+		case matchMediaType(r.mediaType, ContentTypeJSON) && acceptable(ranges, ContentTypeJSON):
+			return false, nil
+		case matchMediaType(r.mediaType, ContentTypeNDJSON) && acceptable(ranges, ContentTypeNDJSON):
+			return true, nil
+		}
+	}
+
+	return false, ErrNotAcceptable
+}
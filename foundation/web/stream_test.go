@@ -0,0 +1,114 @@
+package web_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/piyush-saurabh/go-service/foundation/web"
+)
+
+func TestRespondStream(t *testing.T) {
+	errQuery := errors.New("query failed")
+
+	tt := []struct {
+		name   string
+		accept string
+		values int
+		err    error
+		body   string
+		expErr error
+	}{
+		{"a JSON array", "", 3, nil, `[{"n":0},{"n":1},{"n":2}]`, nil},
+		{"an empty JSON array", "application/json", 0, nil, `[]`, nil},
+		{"NDJSON", "application/x-ndjson", 2, nil, "{\"n\":0}\n{\"n\":1}\n", nil},
+		{"a failure before the first value", "", 0, errQuery, "", errQuery},
+		{"a failure after the first value", "", 2, errQuery, `[{"n":0},{"n":1}`, web.ErrStreamAborted},
+		{"NDJSON when JSON is refused", "application/json;q=0, */*", 1, nil, "{\"n\":0}\n", nil},
+		{"an unsupported type", "text/csv", 1, nil, "", web.ErrNotAcceptable},
+	}
+
+	t.Log("Given the need to stream responses.")
+	{
+		for testID, tc := range tt {
+			t.Logf("\tTest %d:\tWhen streaming %s.", testID, tc.name)
+			{
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				if tc.accept != "" {
+					r.Header.Set("Accept", tc.accept)
+				}
+				w := httptest.NewRecorder()
+
+				stream := func(send func(v interface{}) error) error {
+					for i := 0; i < tc.values; i++ {
+						if err := send(struct {
+							N int `json:"n"`
+						}{i}); err != nil {
+							return err
+						}
+					}
+					return tc.err
+				}
+
+				var err error
+				h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+					err = web.RespondStream(ctx, w, http.StatusOK, stream)
+					return nil
+				}
+				app := web.NewApp(nil)
+				app.Handle(http.MethodGet, "", "/", h)
+				app.ServeHTTP(w, r)
+
+				if tc.expErr != nil {
+					if !errors.Is(err, tc.expErr) {
+						t.Fatalf("\t%s\tTest %d:\tShould fail with %v : %v.", failed, testID, tc.expErr, err)
+					}
+					t.Logf("\t%s\tTest %d:\tShould fail with %v.", success, testID, tc.expErr)
+				} else if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to stream : %v.", failed, testID, err)
+				}
+
+				if got := w.Body.String(); got != tc.body {
+					t.Fatalf("\t%s\tTest %d:\tShould get the streamed body : got %q, exp %q.", failed, testID, got, tc.body)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get the streamed body.", success, testID)
+			}
+		}
+
+		testID := len(tt)
+		t.Logf("\tTest %d:\tWhen the client goes away.", testID)
+		{
+			ctx, cancel := context.WithCancel(context.Background())
+			r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+
+			var sent int
+			stream := func(send func(v interface{}) error) error {
+				for {
+					if err := send(sent); err != nil {
+						return err
+					}
+					sent++
+					if sent == 5 {
+						cancel()
+					}
+				}
+			}
+
+			var err error
+			h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+				err = web.RespondStream(ctx, w, http.StatusOK, stream)
+				return nil
+			}
+			app := web.NewApp(nil)
+			app.Handle(http.MethodGet, "", "/", h)
+			app.ServeHTTP(httptest.NewRecorder(), r)
+
+			if !errors.Is(err, web.ErrStreamAborted) || sent != 5 {
+				t.Fatalf("\t%s\tTest %d:\tShould stop streaming after the client went away : sent %d : %v.", failed, testID, sent, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould stop streaming after the client went away.", success, testID)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package web
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AddSpan adds an OpenTelemetry span to the trace and context. The caller is
+// responsible for ending the span.
+func AddSpan(ctx context.Context, spanName string, keyValues ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx, span := otel.GetTracerProvider().Tracer("").Start(ctx, spanName)
+	span.SetAttributes(keyValues...)
+
+	return ctx, span
+}
+
+// SpanError records the error on the span and marks the span as failed so it
+// is highlighted in the tracing backend.
+func SpanError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -5,12 +5,15 @@ import (
 	"context"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/dimfeld/httptreemux/v5"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
-	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 // [PS] This handler function is used to overcome the limitation of httptreemux handler. This will be inner layer of onion
@@ -23,10 +26,21 @@ type Handler func(ctx context.Context, w http.ResponseWriter, r *http.Request) e
 // object for each of our http handlers. Feel free to add any configuration
 // data/logic on this App struct.
 type App struct {
-	mux      *httptreemux.ContextMux
-	otmux    http.Handler // [PS] open telemetry support. use open telemetry as Handler
-	shutdown chan os.Signal
-	mw       []Middleware
+	mux         *httptreemux.ContextMux
+	otmux       http.Handler // [PS] open telemetry support. use open telemetry as Handler
+	shutdown    chan os.Signal
+	mw          []Middleware
+	maxBodySize int64
+	check       func(val interface{}) error
+	routes      map[string]*route
+}
+
+// route tracks the methods registered for a path so OPTIONS requests for the
+// path can be answered.
+type route struct {
+	methods []string
+	options Handler // replaces the automatic answer to OPTIONS when set
+	handled bool    // the OPTIONS handler is registered with the mux
 }
 
 // NewApp creates an App value that handle a set of routes for the application.
@@ -42,13 +56,29 @@ func NewApp(shutdown chan os.Signal, mw ...Middleware) *App {
 	mux := httptreemux.NewContextMux()
 
 	return &App{
-		mux:      mux,
-		otmux:    otelhttp.NewHandler(mux, "request"), // [PS] open telemetry mux is not the outmost layer of the onion
-		shutdown: shutdown,
-		mw:       mw,
+		mux:         mux,
+		otmux:       otelhttp.NewHandler(mux, "request"), // [PS] open telemetry mux is not the outmost layer of the onion
+		shutdown:    shutdown,
+		mw:          mw,
+		maxBodySize: DefaultMaxBodySize,
+		routes:      make(map[string]*route),
 	}
 }
 
+// SetMaxBodySize sets the limit on the size of request bodies for all the
+// routes of the app. Routes can replace it with the MaxBodySize middleware.
+// A limit of zero or less removes the limit.
+func (a *App) SetMaxBodySize(n int64) {
+	a.maxBodySize = n
+}
+
+// SetCheck sets the function Decode uses to check decoded structs against
+// their validation tags, for all the routes of the app. Without it only
+// values implementing Validator are validated.
+func (a *App) SetCheck(fn func(val interface{}) error) {
+	a.check = fn
+}
+
 // SignalShutdown is used to gracefully shutdown the app when an integrity
 // issue is identified.
 func (a *App) SignalShutdown() {
@@ -67,12 +97,87 @@ func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 // Handle sets a handler function for a given HTTP method and path pair
 // to the application server mux.
 // [PS] group can be used for versioning v1, v2
+//
+// Every path with a handler answers OPTIONS requests with the methods it
+// supports, through the application's middleware so CORS preflight requests
+// are handled. Registering OPTIONS for a path replaces that answer, and a nil
+// handler keeps it but runs the route's middleware around it.
 func (a *App) Handle(method string, group string, path string, handler Handler, mw ...Middleware) {
 
+	// Setting up the group (versioning)
+	finalPath := path
+	if group != "" {
+		finalPath = "/" + group + path
+	}
+
+	rt, exists := a.routes[finalPath]
+	if !exists {
+		rt = &route{}
+		a.routes[finalPath] = rt
+	}
+
+	if method == http.MethodOptions {
+		if handler == nil {
+			handler = allowed(rt)
+		}
+		rt.options = wrapMiddleware(mw, handler)
+		a.handleOptions(finalPath, rt)
+		return
+	}
+
+	rt.methods = append(rt.methods, method)
+	a.handleOptions(finalPath, rt)
+
 	// First wrap handler specific middleware around this handler.
 	// [PS] This will INJECT the middleware code and return the new handler
 	handler = wrapMiddleware(mw, handler)
 
+	a.handle(method, finalPath, handler)
+}
+
+// handleOptions registers the handler answering OPTIONS requests for the
+// path, unless it is already registered.
+func (a *App) handleOptions(finalPath string, rt *route) {
+	if rt.handled {
+		return
+	}
+	rt.handled = true
+
+	h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		if rt.options != nil {
+			return rt.options(ctx, w, r)
+		}
+		return allowed(rt)(ctx, w, r)
+	}
+
+	a.handle(http.MethodOptions, finalPath, h)
+}
+
+// allowed returns the handler answering OPTIONS requests with the methods
+// registered for the route.
+func allowed(rt *route) Handler {
+	h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		methods := make([]string, 0, len(rt.methods)+2)
+		for _, method := range rt.methods {
+			methods = append(methods, method)
+
+			// The mux answers HEAD requests with the GET handler.
+			if method == http.MethodGet {
+				methods = append(methods, http.MethodHead)
+			}
+		}
+		methods = append(methods, http.MethodOptions)
+
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		return Respond(ctx, w, nil, http.StatusNoContent)
+	}
+	return h
+}
+
+// handle wraps the application's middleware around the handler and registers
+// it with the mux.
+func (a *App) handle(method string, finalPath string, handler Handler) {
+
 	// Add the application's general middleware to the handler chain.
 	handler = wrapMiddleware(a.mw, handler)
 
@@ -86,22 +191,47 @@ func (a *App) Handle(method string, group string, path string, handler Handler,
 		// use it as a separate parameter.
 		ctx := r.Context()
 
-		// Capture the parent request span from the context.
+		// Start a span for the route so each handler shows up in the trace
+		// under its route pattern and not just the root "request" span.
 		// [PS] from the span, we can get the trace ID using: span.SpanContext().TraceID().String()
-		span := trace.SpanFromContext(ctx)
+		ctx, span := AddSpan(ctx, finalPath,
+			attribute.String("http.method", r.Method),
+			attribute.String("http.route", finalPath),
+		)
+		defer span.End()
 
 		// Set the context with the required values to
 		// process the request.
 		v := Values{
 			TraceID: span.SpanContext().TraceID().String(), // Generated using OpenTelemetry. alternative google uuid: uuid.New().String()
+			Route:   finalPath,
 			Now:     time.Now(),
+			Accept:  r.Header.Get("Accept"),
 		}
+		v.Pretty, _ = strconv.ParseBool(r.URL.Query().Get("pretty"))
 		ctx = context.WithValue(ctx, key, &v) // key is package level variable in context.go
 
+		// Limit how much of the body handlers can read.
+		r.Body = limitBody(r.Body, a.maxBodySize)
+
+		// Give Decode the function checking the structs it decodes.
+		if a.check != nil {
+			r = r.WithContext(context.WithValue(r.Context(), checkKey, a.check))
+		}
+
 		// Call the wrapped handler functions.
 		// [PS] context is passed to upper layer layer of the onion
-		if err := handler(ctx, w, r); err != nil {
+		err := handler(ctx, w, r)
+
+		// Record the final status code of the request on the route span.
+		span.SetAttributes(attribute.Int("http.status_code", v.StatusCode))
+		if v.StatusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(v.StatusCode))
+		}
+
+		if err != nil {
 			// [PS] if error is in inner layer, there is something wrong so shutdown
+			SpanError(span, err)
 			a.SignalShutdown()
 			return
 		}
@@ -111,11 +241,5 @@ func (a *App) Handle(method string, group string, path string, handler Handler,
 
 	}
 
-	// Setting up the group (versioning)
-	finalPath := path
-	if group != "" {
-		finalPath = "/" + group + path
-	}
-
 	a.mux.Handle(method, finalPath, h)
 }
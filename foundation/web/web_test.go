@@ -0,0 +1,98 @@
+package web_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/piyush-saurabh/go-service/foundation/web"
+)
+
+func TestOptions(t *testing.T) {
+	h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return web.Respond(ctx, w, nil, http.StatusNoContent)
+	}
+	custom := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("Allow", "GET")
+		return web.Respond(ctx, w, nil, http.StatusOK)
+	}
+
+	app := web.NewApp(nil)
+	app.Handle(http.MethodGet, "v1", "/users/:id", h)
+	app.Handle(http.MethodPut, "v1", "/users/:id", h)
+	app.Handle(http.MethodDelete, "v1", "/users/:id", h)
+	app.Handle(http.MethodPost, "v1", "/users", h)
+	app.Handle(http.MethodOptions, "v1", "/users", custom)
+
+	tt := []struct {
+		name       string
+		path       string
+		statusCode int
+		allow      string
+	}{
+		{"a path with handlers", "/v1/users/1", http.StatusNoContent, "GET, HEAD, PUT, DELETE, OPTIONS"},
+		{"a path with an OPTIONS handler", "/v1/users", http.StatusOK, "GET"},
+		{"an unknown path", "/v1/products", http.StatusNotFound, ""},
+	}
+
+	t.Log("Given the need to answer OPTIONS requests.")
+	{
+		for testID, tc := range tt {
+			t.Logf("\tTest %d:\tWhen asking for %s.", testID, tc.name)
+			{
+				r := httptest.NewRequest(http.MethodOptions, tc.path, nil)
+				w := httptest.NewRecorder()
+				app.ServeHTTP(w, r)
+
+				if w.Code != tc.statusCode {
+					t.Fatalf("\t%s\tTest %d:\tShould receive a status code of %d : %d.", failed, testID, tc.statusCode, w.Code)
+				}
+				t.Logf("\t%s\tTest %d:\tShould receive a status code of %d.", success, testID, tc.statusCode)
+
+				if got := w.Header().Get("Allow"); got != tc.allow {
+					t.Fatalf("\t%s\tTest %d:\tShould allow %q : got %q.", failed, testID, tc.allow, got)
+				}
+				t.Logf("\t%s\tTest %d:\tShould allow %q.", success, testID, tc.allow)
+			}
+		}
+	}
+}
+
+func TestWriteDeadline(t *testing.T) {
+	t.Log("Given the need to respond past the server's write timeout.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a handler extends the write deadline.", testID)
+		{
+			h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+				if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Second)); err != nil {
+					return err
+				}
+				time.Sleep(100 * time.Millisecond)
+				return web.Respond(ctx, w, "done", http.StatusOK)
+			}
+			app := web.NewApp(nil)
+			app.Handle(http.MethodGet, "", "/", h)
+
+			srv := httptest.NewUnstartedServer(app)
+			srv.Config.WriteTimeout = 50 * time.Millisecond
+			srv.Start()
+			defer srv.Close()
+
+			resp, err := http.Get(srv.URL)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould get the response : %v.", failed, testID, err)
+			}
+			defer resp.Body.Close()
+
+			b, err := io.ReadAll(resp.Body)
+			if err != nil || string(b) != `"done"` {
+				t.Fatalf("\t%s\tTest %d:\tShould get the response : %q : %v.", failed, testID, b, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the response.", success, testID)
+		}
+	}
+}